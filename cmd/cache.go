@@ -0,0 +1,414 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/auth"
+	"github.com/chinnareddy578/kubectl-login/pkg/cache"
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+	"github.com/chinnareddy578/kubectl-login/pkg/session"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// envCachePassphrase holds the passphrase for the encrypted-file cache
+// backend. It is never read from the config file.
+const envCachePassphrase = config.EnvPrefix + "CACHE_PASSPHRASE"
+
+// newTokenCache opens the token cache with the backend selected in cfg
+func newTokenCache(cfg *config.Config) (*cache.TokenCache, error) {
+	if cfg.NoCache {
+		// Nothing may touch the disk, not even the cache directory
+		tokenCache, err := cache.NewTokenCache(cache.WithStore(cache.NewMemoryStore()))
+		if err != nil {
+			return nil, cacheError(err)
+		}
+		return tokenCache, nil
+	}
+
+	dir, err := cacheDirectory(cfg)
+	if err != nil {
+		return nil, cacheError(err)
+	}
+	store, err := newCacheStore(cfg, dir)
+	if err != nil {
+		return nil, cacheError(err)
+	}
+	opts := []cache.Option{cache.WithStore(store), cache.WithDir(dir), cache.WithWarnings(warn)}
+	tokenCache, err := cache.NewTokenCache(opts...)
+	// Permissions are reported one path at a time: the directory, then the file
+	for attempt := 0; attempt < 2 && err != nil && canPrompt() && fixPermissions(err, os.Stdin, os.Stderr); attempt++ {
+		tokenCache, err = cache.NewTokenCache(opts...)
+	}
+	if err != nil {
+		return nil, cacheError(err)
+	}
+	return tokenCache, nil
+}
+
+// canPrompt reports whether the user can answer a question on the terminal
+func canPrompt() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// fixPermissions offers to remove the group and world permissions reported
+// by an InsecureError and reports whether they were removed
+func fixPermissions(err error, in io.Reader, out io.Writer) bool {
+	var insecure *cache.InsecureError
+	if !errors.As(err, &insecure) || insecure.OtherOwner {
+		return false
+	}
+
+	fmt.Fprintf(out, "%s is accessible to other users (mode %04o). Change it to %04o? [y/N] ",
+		insecure.Path, insecure.Mode.Perm(), insecure.FixedMode().Perm())
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	if answer := strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		return false
+	}
+
+	if err := insecure.Fix(); err != nil {
+		fmt.Fprintf(out, "Failed to change permissions: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// cacheDirectory returns the directory of the token cache: cache_dir if set,
+// otherwise the default
+func cacheDirectory(cfg *config.Config) (string, error) {
+	if cfg.CacheDir != "" {
+		return cfg.CacheDir, nil
+	}
+	return cache.DefaultDir()
+}
+
+// newCacheStore creates the storage backend selected in cfg, keeping files in dir
+func newCacheStore(cfg *config.Config, dir string) (cache.Store, error) {
+	switch cfg.CacheBackend {
+	case "", config.CacheBackendFile:
+		return cache.NewFileStore(filepath.Join(dir, "tokens.json")), nil
+
+	case config.CacheBackendEncryptedFile:
+		var key cache.EncryptionKey
+		if cfg.CacheKeyFile != "" {
+			var err error
+			if key, err = cache.KeyFile(cfg.CacheKeyFile); err != nil {
+				return nil, err
+			}
+		} else if passphrase := os.Getenv(envCachePassphrase); passphrase != "" {
+			key = cache.PassphraseKey(passphrase)
+		} else {
+			return nil, fmt.Errorf("the %s cache backend needs --cache-key-file or %s", config.CacheBackendEncryptedFile, envCachePassphrase)
+		}
+		return cache.NewEncryptedFileStore(filepath.Join(dir, "tokens.enc"), key), nil
+
+	case config.CacheBackendMemory:
+		return cache.NewMemoryStore(), nil
+
+	case config.CacheBackendKeyring:
+		return cache.NewKeyringStore()
+	}
+
+	return nil, fmt.Errorf("unknown cache backend %q", cfg.CacheBackend)
+}
+
+var (
+	cacheListOutput  string
+	cachePruneVerify bool
+	cacheClearIssuer string
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "List, prune and clear cached tokens",
+	Long: `cache manages the tokens in the cache selected by --cache-backend. Tokens
+themselves are never printed.`,
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached tokens",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheList,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove tokens that can no longer be used or refreshed",
+	Long: `prune removes cached tokens whose refresh token has expired, and expired
+tokens without a refresh token. With --verify the remaining refresh tokens are
+also checked at their provider and removed if the provider rejects them; tokens
+refreshed successfully are updated in the cache.`,
+	Args: cobra.NoArgs,
+	RunE: runCachePrune,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove cached tokens",
+	Long: `clear removes all cached tokens, or with --issuer only the tokens of that
+issuer. Unlike logout, the tokens are not revoked at the provider.`,
+	Args: cobra.NoArgs,
+	RunE: runCacheClear,
+}
+
+func init() {
+	cacheListCmd.Flags().StringVarP(&cacheListOutput, "output", "o", "table", "Output format: table or json")
+	cachePruneCmd.Flags().BoolVar(&cachePruneVerify, "verify", false, "Also check the remaining refresh tokens at their provider")
+	cacheClearCmd.Flags().StringVar(&cacheClearIssuer, "issuer", "", "Only remove the tokens of this issuer URL")
+
+	cacheCmd.AddCommand(cacheListCmd, cachePruneCmd, cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+// openCache opens the token cache for the cache subcommands, which don't
+// need a provider to be configured
+func openCache(cmd *cobra.Command) (*config.Config, *cache.TokenCache, error) {
+	cfg, err := resolveConfig(cmd.Flags(), "", currentKubeContext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	tokenCache, err := newTokenCache(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, tokenCache, nil
+}
+
+// cacheListEntry describes a cached token without its secrets
+type cacheListEntry struct {
+	IssuerURL          string            `json:"issuer_url"`
+	ClientID           string            `json:"client_id"`
+	Subject            string            `json:"subject,omitempty"`
+	Scopes             []string          `json:"scopes,omitempty"`
+	AuthParams         map[string]string `json:"auth_params,omitempty"`
+	LoginHint          string            `json:"login_hint,omitempty"`
+	TokenType          string            `json:"token_type"`
+	Expiry             time.Time         `json:"expiry"`
+	Expired            bool              `json:"expired"`
+	HasRefreshToken    bool              `json:"has_refresh_token"`
+	RefreshTokenExpiry *time.Time        `json:"refresh_token_expiry,omitempty"`
+}
+
+func newCacheListEntry(entry cache.Entry, now time.Time) cacheListEntry {
+	expiry := entryExpiry(entry)
+	listEntry := cacheListEntry{
+		IssuerURL:       entry.Key.IssuerURL,
+		ClientID:        entry.Key.ClientID,
+		Subject:         entry.Key.Subject,
+		Scopes:          entry.Key.Scopes,
+		AuthParams:      entry.Key.AuthParams,
+		LoginHint:       entry.Key.LoginHint,
+		TokenType:       entry.Key.TokenType,
+		Expiry:          expiry,
+		Expired:         !expiry.After(now),
+		HasRefreshToken: entry.Token.RefreshToken != "",
+	}
+	if refreshExpiry, ok := auth.RefreshTokenExpiry(entry.Token.RefreshToken); ok {
+		listEntry.RefreshTokenExpiry = &refreshExpiry
+	}
+	return listEntry
+}
+
+func runCacheList(cmd *cobra.Command, args []string) error {
+	if cacheListOutput != "table" && cacheListOutput != "json" {
+		return fmt.Errorf("invalid output format %q: must be table or json", cacheListOutput)
+	}
+
+	_, tokenCache, err := openCache(cmd)
+	if err != nil {
+		return err
+	}
+	return writeCacheList(os.Stdout, tokenCache.Entries(), cacheListOutput, time.Now())
+}
+
+// writeCacheList writes entries as a table or as JSON
+func writeCacheList(out io.Writer, entries []cache.Entry, output string, now time.Time) error {
+	list := make([]cacheListEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, newCacheListEntry(entry, now))
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(list)
+	}
+
+	if len(list) == 0 {
+		fmt.Fprintln(out, "No cached tokens.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ISSUER\tCLIENT\tSUBJECT\tTOKEN TYPE\tSCOPES\tEXPIRES\tREFRESH")
+	for _, entry := range list {
+		expires := entry.Expiry.Local().Format(time.RFC3339)
+		if entry.Expired {
+			expires += " (expired)"
+		}
+		refresh := "no"
+		if entry.HasRefreshToken {
+			refresh = "yes"
+			if entry.RefreshTokenExpiry != nil && !entry.RefreshTokenExpiry.After(now) {
+				refresh = "expired"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.IssuerURL, entry.ClientID, orDash(entry.Subject),
+			entry.TokenType, strings.Join(entry.Scopes, ","), expires, refresh)
+	}
+	return w.Flush()
+}
+
+func runCachePrune(cmd *cobra.Command, args []string) error {
+	cfg, tokenCache, err := openCache(cmd)
+	if err != nil {
+		return err
+	}
+
+	entries := tokenCache.Entries()
+	removed := 0
+	for _, entry := range entries {
+		reason := pruneReason(entry, time.Now())
+		if reason == "" && cachePruneVerify && entry.Token.RefreshToken != "" {
+			reason, err = verifyRefreshToken(cfg, tokenCache, entry)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: could not check %s: %v\n", describeKey(entry.Key), err)
+			}
+		}
+		if reason == "" {
+			continue
+		}
+
+		if err := tokenCache.Clear(entry.Key); err != nil {
+			return cacheError(err)
+		}
+		removed++
+		fmt.Printf("Removed %s: %s\n", describeKey(entry.Key), reason)
+	}
+
+	fmt.Printf("Pruned %d of %d cached tokens.\n", removed, len(entries))
+	return nil
+}
+
+// pruneReason returns why entry can be pruned without asking its provider,
+// or "" if it may still be usable
+func pruneReason(entry cache.Entry, now time.Time) string {
+	if entry.Token.RefreshToken == "" {
+		if !entryExpiry(entry).After(now) {
+			return "expired and no refresh token"
+		}
+		return ""
+	}
+	if expiry, ok := auth.RefreshTokenExpiry(entry.Token.RefreshToken); ok && !expiry.After(now) {
+		return "refresh token expired"
+	}
+	return ""
+}
+
+// verifyRefreshToken refreshes entry at its provider, storing the refreshed
+// token under the key of its user like a session does, and removing entry if
+// that key differs. It returns a prune reason if the provider rejected the
+// refresh token.
+func verifyRefreshToken(cfg *config.Config, tokenCache *cache.TokenCache, entry cache.Entry) (string, error) {
+	refreshCfg := &config.Config{
+		IssuerURL:  entry.Key.IssuerURL,
+		ClientID:   entry.Key.ClientID,
+		Scopes:     entry.Key.Scopes,
+		AuthParams: entry.Key.AuthParams,
+		TokenType:  entry.Key.TokenType,
+		LoginHint:  entry.Key.LoginHint,
+	}
+	// Confidential clients need the secret of the configured client
+	if cfg.IssuerURL == entry.Key.IssuerURL && cfg.ClientID == entry.Key.ClientID {
+		refreshCfg.ClientSecret = cfg.ClientSecret
+	}
+
+	refreshed, err := auth.NewAuthenticator(refreshCfg).RefreshToken(entry.Token)
+	if auth.IsInvalidGrant(err) {
+		return "refresh token rejected by the provider", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	key := session.TokenKey(entry.Key, refreshed)
+	if err := tokenCache.Set(key, refreshed); err != nil {
+		return "", err
+	}
+	if key.String() != entry.Key.String() {
+		return "", tokenCache.Clear(entry.Key)
+	}
+	return "", nil
+}
+
+func runCacheClear(cmd *cobra.Command, args []string) error {
+	_, tokenCache, err := openCache(cmd)
+	if err != nil {
+		return err
+	}
+
+	removed, err := clearCache(tokenCache, cacheClearIssuer)
+	fmt.Printf("Removed %d cached tokens.\n", removed)
+	if err != nil {
+		return cacheError(err)
+	}
+	return nil
+}
+
+// clearCache removes the tokens of issuer, or all tokens if issuer is empty,
+// and returns how many were removed
+func clearCache(tokenCache *cache.TokenCache, issuer string) (int, error) {
+	removed := 0
+	for _, entry := range tokenCache.Entries() {
+		if issuer != "" && strings.TrimSuffix(entry.Key.IssuerURL, "/") != strings.TrimSuffix(issuer, "/") {
+			continue
+		}
+		if err := tokenCache.Clear(entry.Key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// entryExpiry returns when the credential of entry expires, preferring the
+// exp claim of the token kubectl is given over the token endpoint's expiry
+func entryExpiry(entry cache.Entry) time.Time {
+	if _, expiry, err := auth.CredentialToken(entry.Token, entry.Key.TokenType); err == nil {
+		return expiry
+	}
+	return entry.Token.Expiry
+}
+
+// describeKey returns a short description of key for messages
+func describeKey(key cache.Key) string {
+	description := fmt.Sprintf("%s (%s)", key.IssuerURL, key.ClientID)
+	if key.LoginHint != "" {
+		description += " " + key.LoginHint
+	}
+	if key.Subject != "" {
+		description += " " + key.Subject
+	}
+	return description
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/auth"
+	"github.com/chinnareddy578/kubectl-login/pkg/cache"
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+	"github.com/chinnareddy578/kubectl-login/pkg/session"
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+func TestNewTokenCache_Location(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	key := cache.NewKey(&config.Config{IssuerURL: "https://issuer.com", ClientID: "client"})
+
+	dir := t.TempDir()
+	os.Chmod(dir, 0700)
+	tokenCache, err := newTokenCache(&config.Config{CacheDir: dir})
+	if err != nil {
+		t.Fatalf("newTokenCache failed: %v", err)
+	}
+	if err := tokenCache.Set(key, &types.TokenInfo{AccessToken: "token"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tokens.json")); err != nil {
+		t.Errorf("expected the cache in --cache-dir: %v", err)
+	}
+
+	// --no-cache writes nothing, not even lock files
+	empty := t.TempDir()
+	cfg := &config.Config{CacheDir: empty, NoCache: true}
+	if tokenCache, err = newTokenCache(cfg); err != nil {
+		t.Fatalf("newTokenCache failed: %v", err)
+	}
+	if _, err := newSession(cfg, tokenCache).Token(session.Request{NoLogin: true}); !errors.Is(err, session.ErrLoginRequired) {
+		t.Fatalf("expected ErrLoginRequired, got %v", err)
+	}
+	tokenCache.Set(key, &types.TokenInfo{AccessToken: "token"})
+	if entries, _ := os.ReadDir(empty); len(entries) != 0 {
+		t.Errorf("--no-cache should not write to disk, found %v", entries)
+	}
+}
+
+func TestNewCacheStore(t *testing.T) {
+	t.Setenv(envCachePassphrase, "")
+	dir := t.TempDir()
+
+	if store, err := newCacheStore(&config.Config{}, dir); err != nil {
+		t.Errorf("default backend failed: %v", err)
+	} else if fileStore, ok := store.(*cache.FileStore); !ok || fileStore.Path() != filepath.Join(dir, "tokens.json") {
+		t.Errorf("default backend should be the file store in the cache dir, got %T", store)
+	}
+
+	if store, err := newCacheStore(&config.Config{CacheBackend: config.CacheBackendMemory}, dir); err != nil {
+		t.Errorf("memory backend failed: %v", err)
+	} else if _, ok := store.(*cache.MemoryStore); !ok {
+		t.Errorf("expected the memory store, got %T", store)
+	}
+
+	// The encrypted backend needs a key
+	_, err := newCacheStore(&config.Config{CacheBackend: config.CacheBackendEncryptedFile}, dir)
+	if err == nil || !strings.Contains(err.Error(), envCachePassphrase) {
+		t.Errorf("expected an error naming %s, got %v", envCachePassphrase, err)
+	}
+
+	t.Setenv(envCachePassphrase, "secret")
+	if store, err := newCacheStore(&config.Config{CacheBackend: config.CacheBackendEncryptedFile}, dir); err != nil {
+		t.Errorf("encrypted backend with passphrase failed: %v", err)
+	} else if fileStore, ok := store.(*cache.FileStore); !ok || filepath.Base(fileStore.Path()) != "tokens.enc" {
+		t.Errorf("expected the encrypted file store, got %T", store)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "cache.key")
+	os.WriteFile(keyFile, []byte("short"), 0600)
+	if _, err := newCacheStore(&config.Config{CacheBackend: config.CacheBackendEncryptedFile, CacheKeyFile: keyFile}, dir); err == nil {
+		t.Error("expected an error for an invalid key file")
+	}
+}
+
+// jwtWithExpiry builds an unsigned JWT expiring at exp
+func jwtWithExpiry(exp time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix())))
+	return header + "." + payload + ".signature"
+}
+
+func TestWriteCacheList(t *testing.T) {
+	now := time.Now()
+	key := cache.NewKey(&config.Config{IssuerURL: "https://issuer.com", ClientID: "client"})
+	entries := []cache.Entry{
+		{Key: key.WithSubject("alice"), Token: &types.TokenInfo{AccessToken: "secret-access", RefreshToken: "secret-refresh", IDToken: jwtWithExpiry(now.Add(time.Hour))}},
+		{Key: key, Token: &types.TokenInfo{AccessToken: "secret-access", Expiry: now.Add(-time.Hour)}},
+	}
+
+	var table bytes.Buffer
+	if err := writeCacheList(&table, entries, "table", now); err != nil {
+		t.Fatalf("writeCacheList failed: %v", err)
+	}
+	if strings.Contains(table.String(), "secret") {
+		t.Error("cache list must not print tokens")
+	}
+	if !strings.Contains(table.String(), "alice") || !strings.Contains(table.String(), "(expired)") {
+		t.Errorf("unexpected table:\n%s", table.String())
+	}
+
+	var out bytes.Buffer
+	if err := writeCacheList(&out, entries, "json", now); err != nil {
+		t.Fatalf("writeCacheList failed: %v", err)
+	}
+	var list []cacheListEntry
+	if err := json.Unmarshal(out.Bytes(), &list); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if len(list) != 2 || list[0].Subject != "alice" || !list[0].HasRefreshToken || list[0].Expired {
+		t.Errorf("unexpected first entry: %+v", list)
+	}
+	if list[1].HasRefreshToken || !list[1].Expired {
+		t.Errorf("unexpected second entry: %+v", list[1])
+	}
+}
+
+func TestPruneReason(t *testing.T) {
+	now := time.Now()
+	key := cache.NewKey(&config.Config{IssuerURL: "https://issuer.com", ClientID: "client"})
+
+	tests := []struct {
+		name  string
+		token *types.TokenInfo
+		prune bool
+	}{
+		{"valid without refresh token", &types.TokenInfo{IDToken: jwtWithExpiry(now.Add(time.Hour))}, false},
+		{"expired without refresh token", &types.TokenInfo{IDToken: jwtWithExpiry(now.Add(-time.Hour))}, true},
+		{"expired with opaque refresh token", &types.TokenInfo{RefreshToken: "opaque", Expiry: now.Add(-time.Hour)}, false},
+		{"expired refresh token", &types.TokenInfo{RefreshToken: jwtWithExpiry(now.Add(-time.Minute))}, true},
+		{"valid refresh token", &types.TokenInfo{RefreshToken: jwtWithExpiry(now.Add(time.Hour))}, false},
+	}
+	for _, tt := range tests {
+		if reason := pruneReason(cache.Entry{Key: key, Token: tt.token}, now); (reason != "") != tt.prune {
+			t.Errorf("%s: got reason %q, want prune=%v", tt.name, reason, tt.prune)
+		}
+	}
+}
+
+func TestVerifyRefreshToken(t *testing.T) {
+	mockProvider := auth.NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	cfg := &config.Config{IssuerURL: mockProvider.IssuerURL, ClientID: "client"}
+	tokenCache, _ := cache.NewTokenCache(cache.WithStore(cache.NewMemoryStore()))
+	entry := cache.Entry{Key: cache.NewKey(cfg), Token: &types.TokenInfo{RefreshToken: "revoked"}}
+
+	reason, err := verifyRefreshToken(cfg, tokenCache, entry)
+	if err != nil || reason == "" {
+		t.Errorf("expected a rejected refresh token to be pruned, got %q, %v", reason, err)
+	}
+
+	// A refreshed token moves to the key of its user, as in a session
+	cfg.ClientID = "test-client-id"
+	mockProvider.Tokens["code"] = &auth.MockToken{RefreshToken: "valid"}
+	entry = cache.Entry{Key: cache.NewKey(cfg), Token: &types.TokenInfo{RefreshToken: "valid"}}
+	tokenCache.Set(entry.Key, entry.Token)
+	if reason, err := verifyRefreshToken(cfg, tokenCache, entry); err != nil || reason != "" {
+		t.Fatalf("expected the refresh token to be kept, got %q, %v", reason, err)
+	}
+	entries := tokenCache.Entries()
+	if len(entries) != 1 || entries[0].Key.Subject != "test-user-123" {
+		t.Errorf("expected one entry keyed by the subject, got %v", entries)
+	}
+}
+
+func TestClearCache(t *testing.T) {
+	tokenCache, _ := cache.NewTokenCache(cache.WithStore(cache.NewMemoryStore()))
+	for _, issuer := range []string{"https://a.example.com", "https://b.example.com"} {
+		for _, client := range []string{"one", "two"} {
+			tokenCache.Set(cache.NewKey(&config.Config{IssuerURL: issuer, ClientID: client}), &types.TokenInfo{AccessToken: "token"})
+		}
+	}
+
+	if removed, err := clearCache(tokenCache, "https://a.example.com/"); err != nil || removed != 2 {
+		t.Errorf("expected 2 tokens of issuer a removed, got %d", removed)
+	}
+	for _, entry := range tokenCache.Entries() {
+		if entry.Key.IssuerURL != "https://b.example.com" {
+			t.Errorf("unexpected remaining entry %s", entry.Key)
+		}
+	}
+
+	if removed, err := clearCache(tokenCache, ""); err != nil || removed != 2 || len(tokenCache.Entries()) != 0 {
+		t.Errorf("expected the remaining 2 tokens removed, got %d", removed)
+	}
+}
+
+func TestFixPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not checked on windows")
+	}
+
+	dir := t.TempDir()
+	os.Chmod(dir, 0755)
+	_, err := newTokenCache(&config.Config{CacheDir: dir})
+	var insecure *cache.InsecureError
+	if !errors.As(err, &insecure) || ExitCode(err) != ExitCacheError {
+		t.Fatalf("expected an insecure cache error, got %v", err)
+	}
+
+	var out bytes.Buffer
+	if fixPermissions(err, strings.NewReader("n\n"), &out) {
+		t.Error("declining should not fix the permissions")
+	}
+	if info, _ := os.Stat(dir); info.Mode().Perm() != 0755 {
+		t.Errorf("permissions changed without consent: %04o", info.Mode().Perm())
+	}
+
+	if !fixPermissions(err, strings.NewReader("y\n"), &out) {
+		t.Fatalf("expected the permissions to be fixed, output:\n%s", out.String())
+	}
+	if info, _ := os.Stat(dir); info.Mode().Perm() != 0700 {
+		t.Errorf("expected 0700, got %04o", info.Mode().Perm())
+	}
+	if _, err := newTokenCache(&config.Config{CacheDir: dir}); err != nil {
+		t.Errorf("newTokenCache failed after fixing permissions: %v", err)
+	}
+}
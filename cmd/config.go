@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	issuerURL    string
+	clientID     string
+	clientSecret string
+	headless     bool
+	port         string
+	manual       bool
+	browserCmd   string
+	configFile   string
+	tokenType    string
+	profile      string
+	kubeContext  string
+	scopes       []string
+	authParams   map[string]string
+	loginHint    string
+	cacheBackend string
+	cacheKeyFile string
+	cacheDir     string
+	noCache      bool
+	minValidity  time.Duration
+)
+
+// addConfigFlags registers the flags that override config settings
+func addConfigFlags(flags *pflag.FlagSet) {
+	defaults := config.Defaults()
+
+	flags.StringVar(&issuerURL, "issuer-url", "", "OIDC issuer URL (env KUBECTL_LOGIN_ISSUER_URL)")
+	flags.StringVar(&clientID, "client-id", "", "OIDC client ID (env KUBECTL_LOGIN_CLIENT_ID)")
+	flags.StringVar(&clientSecret, "client-secret", "", "OIDC client secret (env KUBECTL_LOGIN_CLIENT_SECRET or CLIENT_SECRET)")
+	flags.BoolVar(&headless, "headless", defaults.Headless, "Use headless authentication (for CI/CD) (env KUBECTL_LOGIN_HEADLESS)")
+	flags.StringVar(&port, "port", defaults.Port, "Local port for the OAuth callback: a port, a list or range such as 8000,18000 or 8000-8010, or auto (env KUBECTL_LOGIN_PORT)")
+	flags.BoolVar(&manual, "manual", false, "Log in by pasting the redirect URL from any browser instead of receiving it on a local port (env KUBECTL_LOGIN_MANUAL, default: on in SSH sessions without DISPLAY)")
+	flags.StringVar(&browserCmd, "browser-command", "", "Command that opens the login URL, which is appended as last argument, e.g. \"firefox --private-window\" (env KUBECTL_LOGIN_BROWSER_COMMAND, default: the system browser)")
+	flags.StringVar(&configFile, "config", "", "Path to configuration file (env KUBECTL_LOGIN_CONFIG)")
+	flags.StringVar(&profile, "profile", "", "Profile from the config file (env KUBECTL_LOGIN_PROFILE, default: mapped from the current kubeconfig context)")
+	flags.StringVar(&kubeContext, "context", "", "Kubeconfig context whose profile to use (env KUBECTL_LOGIN_CONTEXT, default: the current context, except for get-token)")
+	flags.StringVar(&tokenType, "token-type", defaults.TokenType, "Token sent to the API server: id_token or access_token (env KUBECTL_LOGIN_TOKEN_TYPE)")
+	flags.StringSliceVar(&scopes, "scopes", nil, "OIDC scopes to request (env KUBECTL_LOGIN_SCOPES, default: openid,profile,email,offline_access)")
+	flags.StringToStringVar(&authParams, "auth-param", nil, "Extra authorization request parameter as key=value, repeatable (env KUBECTL_LOGIN_AUTH_PARAMS)")
+	flags.StringVar(&loginHint, "login-hint", "", "Account to log in with, e.g. an email address, sent to the provider as login_hint; tokens of each account are cached separately (env KUBECTL_LOGIN_LOGIN_HINT)")
+	flags.StringVar(&cacheBackend, "cache-backend", defaults.CacheBackend, "Token cache backend: file, encrypted-file, memory or keyring (env KUBECTL_LOGIN_CACHE_BACKEND)")
+	flags.StringVar(&cacheKeyFile, "cache-key-file", "", "Key file for the encrypted-file cache backend (env KUBECTL_LOGIN_CACHE_KEY_FILE)")
+	flags.StringVar(&cacheDir, "cache-dir", "", "Directory of the token cache and lock files (env KUBECTL_LOGIN_CACHE_DIR, default: user cache directory)")
+	flags.BoolVar(&noCache, "no-cache", false, "Keep tokens in memory only and write nothing to disk, e.g. in CI jobs (env KUBECTL_LOGIN_NO_CACHE)")
+	flags.DurationVar(&minValidity, "min-validity", config.DefaultMinValidity, "Refresh cached tokens that expire within this duration (env KUBECTL_LOGIN_MIN_VALIDITY)")
+}
+
+// loadConfig builds the configuration with the precedence
+// flags > environment variables > config file > defaults
+func loadConfig(flags *pflag.FlagSet) (*config.Config, error) {
+	return loadConfigForProfile(flags, "", currentKubeContext)
+}
+
+// loadConfigForProfile is loadConfig with a profile to use when neither
+// --profile nor KUBECTL_LOGIN_PROFILE is set. Without one, the profile is
+// mapped from --context, or else from the context currentContext returns, if
+// not nil.
+func loadConfigForProfile(flags *pflag.FlagSet, defaultProfile string, currentContext func() string) (*config.Config, error) {
+	cfg, err := resolveConfig(flags, defaultProfile, currentContext)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.IssuerURL == "" {
+		return nil, fmt.Errorf("issuer URL not set: use --issuer-url, KUBECTL_LOGIN_ISSUER_URL or --config")
+	}
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("client ID not set: use --client-id, KUBECTL_LOGIN_CLIENT_ID or --config")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// resolveConfig merges defaults, the config file, environment variables and
+// flags without checking that a provider is configured, for commands such as
+// cache that work without one. The profile is picked as in loadConfigForProfile.
+func resolveConfig(flags *pflag.FlagSet, defaultProfile string, currentContext func() string) (*config.Config, error) {
+	cfg := config.Defaults()
+
+	// Load from config file if provided
+	path := flagOrEnv(flags, "config", configFile)
+	explicitProfile := flagOrEnv(flags, "profile", profile)
+	if path != "" {
+		file, err := config.LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		name := explicitProfile
+		if name == "" {
+			name = defaultProfile
+		}
+		if name == "" {
+			contextName := flagOrEnv(flags, "context", kubeContext)
+			if contextName == "" && currentContext != nil {
+				contextName = currentContext()
+			}
+			name = file.ProfileForContext(contextName)
+		}
+
+		fileCfg, err := file.Profile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Merge(fileCfg)
+	} else if explicitProfile != "" {
+		return nil, fmt.Errorf("--profile requires --config")
+	}
+
+	// Override with environment variables if set
+	if err := config.ApplyEnv(cfg, os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	// Override with explicitly set flags
+	if flags.Changed("issuer-url") {
+		cfg.IssuerURL = issuerURL
+	}
+	if flags.Changed("client-id") {
+		cfg.ClientID = clientID
+	}
+	if flags.Changed("client-secret") {
+		cfg.ClientSecret = clientSecret
+	}
+	if flags.Changed("headless") {
+		cfg.Headless = headless
+	}
+	if flags.Changed("port") {
+		cfg.Port = port
+	}
+	if flags.Changed("manual") {
+		cfg.Manual = manual
+	}
+	if flags.Changed("browser-command") {
+		cfg.BrowserCommand = browserCmd
+	}
+	if flags.Changed("token-type") {
+		cfg.TokenType = tokenType
+	}
+	if flags.Changed("scopes") {
+		cfg.Scopes = scopes
+	}
+	if flags.Changed("auth-param") {
+		cfg.AuthParams = authParams
+	}
+	if flags.Changed("login-hint") {
+		cfg.LoginHint = loginHint
+	}
+	if flags.Changed("cache-backend") {
+		cfg.CacheBackend = cacheBackend
+	}
+	if flags.Changed("cache-key-file") {
+		cfg.CacheKeyFile = cacheKeyFile
+	}
+	if flags.Changed("cache-dir") {
+		dir, err := filepath.Abs(cacheDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve --cache-dir: %w", err)
+		}
+		cfg.CacheDir = dir
+	}
+	if flags.Changed("no-cache") {
+		cfg.NoCache = noCache
+	}
+	if flags.Changed("min-validity") {
+		cfg.MinValidity = minValidity.String()
+	}
+
+	return cfg, nil
+}
+
+// flagOrEnv returns the value of a flag if it was set, otherwise the
+// KUBECTL_LOGIN_* environment variable for it
+func flagOrEnv(flags *pflag.FlagSet, name, value string) string {
+	if flags.Changed(name) {
+		return value
+	}
+	return os.Getenv(config.EnvPrefix + envName(name))
+}
+
+// envName converts a flag name to its environment variable suffix
+func envName(flag string) string {
+	return strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// currentKubeContext returns the current context of the default kubeconfig,
+// or an empty string if it cannot be loaded
+func currentKubeContext() string {
+	kubeconfig, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+	if err != nil {
+		return ""
+	}
+	return kubeconfig.CurrentContext
+}
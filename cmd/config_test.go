@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// parseFlags registers the config flags on a fresh flag set and parses args
+func parseFlags(t *testing.T, args ...string) *pflag.FlagSet {
+	t.Helper()
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	addConfigFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+	return flags
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configData := `issuer_url: https://file-issuer.com
+client_id: file-client
+client_secret: file-secret
+headless: true
+token_type: access_token
+`
+	if err := os.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	t.Setenv("KUBECTL_LOGIN_CONFIG", configPath)
+	t.Setenv("KUBECTL_LOGIN_CLIENT_ID", "env-client")
+	t.Setenv("KUBECTL_LOGIN_CLIENT_SECRET", "env-secret")
+	t.Setenv("KUBECTL_LOGIN_HEADLESS", "true")
+
+	flags := parseFlags(t, "--client-id", "flag-client", "--headless=false")
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+
+	// Defaults
+	if cfg.Port != "8000" {
+		t.Errorf("Expected default port 8000, got %s", cfg.Port)
+	}
+	// Config file over defaults
+	if cfg.IssuerURL != "https://file-issuer.com" {
+		t.Errorf("Expected issuer from config file, got '%s'", cfg.IssuerURL)
+	}
+	if cfg.TokenType != "access_token" {
+		t.Errorf("Expected token type from config file, got '%s'", cfg.TokenType)
+	}
+	// Env over config file
+	if cfg.ClientSecret != "env-secret" {
+		t.Errorf("Expected client secret from env, got '%s'", cfg.ClientSecret)
+	}
+	// Flags over env
+	if cfg.ClientID != "flag-client" {
+		t.Errorf("Expected client ID from flag, got '%s'", cfg.ClientID)
+	}
+	if cfg.Headless {
+		t.Error("Expected --headless=false to override env and config file")
+	}
+}
+
+func TestLoadConfig_Required(t *testing.T) {
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := loadConfig(parseFlags(t, "--client-id", "flag-client")); err == nil {
+		t.Error("Expected error when issuer URL is not set")
+	}
+	if _, err := loadConfig(parseFlags(t, "--issuer-url", "https://test-issuer.com")); err == nil {
+		t.Error("Expected error when client ID is not set")
+	}
+	if _, err := loadConfig(parseFlags(t, "--issuer-url", "https://test-issuer.com", "--client-id", "c", "--profile", "dev")); err == nil {
+		t.Error("Expected error when --profile is used without --config")
+	}
+}
+
+func TestLoadConfig_CacheDirFlag(t *testing.T) {
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+
+	cfg, err := loadConfig(parseFlags(t, "--issuer-url", "https://test-issuer.com", "--client-id", "c", "--cache-dir", "cache"))
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if want, _ := filepath.Abs("cache"); cfg.CacheDir != want {
+		t.Errorf("expected --cache-dir relative to the working directory, got %q", cfg.CacheDir)
+	}
+}
+
+func TestLoadConfig_ContextFlag(t *testing.T) {
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configData := `issuer_url: https://test-issuer.com
+client_id: test-client
+profiles:
+  dev:
+    client_id: dev-client
+  prod:
+    client_id: prod-client
+contexts:
+  prod-cluster: prod
+`
+	if err := os.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := loadConfig(parseFlags(t, "--config", configPath, "--context", "prod-cluster"))
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if cfg.ClientID != "prod-client" {
+		t.Errorf("Expected the profile mapped from --context, got client ID '%s'", cfg.ClientID)
+	}
+
+	t.Setenv("KUBECTL_LOGIN_CONTEXT", "dev")
+	if cfg, err = loadConfig(parseFlags(t, "--config", configPath)); err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if cfg.ClientID != "dev-client" {
+		t.Errorf("Expected the profile named after KUBECTL_LOGIN_CONTEXT, got client ID '%s'", cfg.ClientID)
+	}
+}
+
+func TestLoadConfig_GetTokenIgnoresCurrentContext(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(kubeconfigPath, []byte("apiVersion: v1\nkind: Config\ncurrent-context: prod-cluster\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", kubeconfigPath)
+
+	configPath := filepath.Join(dir, "config.yaml")
+	configData := `issuer_url: https://test-issuer.com
+client_id: test-client
+profiles:
+  prod:
+    client_id: prod-client
+contexts:
+  prod-cluster: prod
+`
+	if err := os.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := loadConfig(parseFlags(t, "--config", configPath))
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if cfg.ClientID != "prod-client" {
+		t.Errorf("Expected the profile of the current context, got client ID '%s'", cfg.ClientID)
+	}
+
+	// kubectl may use another context than the current one, e.g. with --context
+	if cfg, err = loadConfigForProfile(parseFlags(t, "--config", configPath), "", nil); err != nil {
+		t.Fatalf("loadConfigForProfile failed: %v", err)
+	}
+	if cfg.ClientID != "test-client" {
+		t.Errorf("Expected the top-level settings without --context, got client ID '%s'", cfg.ClientID)
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/session"
+)
+
+// Exit codes of kubectl-login, so that scripts can tell why it failed
+const (
+	// ExitError is returned for invalid usage, configuration errors and
+	// anything not covered by a more specific code
+	ExitError = 1
+	// ExitAuthError is returned when logging in or refreshing the token failed
+	ExitAuthError = 2
+	// ExitCacheError is returned when the token cache can't be read or written
+	ExitCacheError = 3
+)
+
+// exitError attaches an exit code to an error
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// authError marks err as an authentication failure
+func authError(err error) error {
+	return &exitError{code: ExitAuthError, err: err}
+}
+
+// cacheError marks err as a token cache failure
+func cacheError(err error) error {
+	return &exitError{code: ExitCacheError, err: err}
+}
+
+// sessionError marks an error returned by a session as a cache failure or an
+// authentication failure
+func sessionError(err error) error {
+	var cacheErr *session.CacheError
+	if errors.As(err, &cacheErr) {
+		return cacheError(err)
+	}
+	return authError(err)
+}
+
+// ExitCode returns the process exit code for an error returned by Execute
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return ExitError
+}
+
+// warn prints a warning to stderr, which kubectl passes through to the user
+// without mixing it into the ExecCredential on stdout
+func warn(err error) {
+	fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{errors.New("invalid flag"), ExitError},
+		{authError(errors.New("access denied")), ExitAuthError},
+		{cacheError(errors.New("permission denied")), ExitCacheError},
+		{fmt.Errorf("wrapped: %w", cacheError(errors.New("permission denied"))), ExitCacheError},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/cache"
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+	"github.com/chinnareddy578/kubectl-login/pkg/execcredential"
+	"github.com/chinnareddy578/kubectl-login/pkg/session"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var getTokenCmd = &cobra.Command{
+	Use:   "get-token",
+	Short: "Print an ExecCredential for kubectl (used in kubeconfig exec entries)",
+	Long: `get-token is the kubectl exec credential plugin entry point. kubectl runs it
+from the exec entry of a kubeconfig user and reads the ExecCredential it
+prints. It uses the cached token when possible, refreshes it when needed,
+and logs in otherwise.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return handleExecCredential(cmd)
+	},
+}
+
+func init() {
+	getTokenCmd.Flags().BoolVar(&forceRefresh, "force-refresh", false, "Refresh the cached token, or log in again, even if it is still valid")
+	rootCmd.AddCommand(getTokenCmd)
+}
+
+// isExecCredentialMode guesses whether kubectl started the root command as exec
+// credential plugin by checking whether stdin is a terminal. Only used with
+// --exec-auto-detect, since it misfires when stdin is redirected.
+func isExecCredentialMode() bool {
+	stat, _ := os.Stdin.Stat()
+	return (stat.Mode() & os.ModeCharDevice) == 0
+}
+
+// handleExecCredential answers the exec credential request passed by kubectl
+func handleExecCredential(cmd *cobra.Command) error {
+	// kubectl passes the exec credential request in the environment
+	request, err := execcredential.ParseRequest(os.Getenv(execcredential.EnvExecInfo), term.IsTerminal(int(os.Stdin.Fd())))
+	if err != nil {
+		return err
+	}
+
+	// A profile named in the cluster's exec extension takes precedence over
+	// --context. kubectl doesn't pass its --context to exec plugins, so the
+	// current context may not be the one kubectl uses and is not consulted.
+	cfg, err := loadConfigForProfile(cmd.Flags(), request.Cluster.Profile(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	tokenCache, err := newTokenCache(cfg)
+	if err != nil {
+		return err
+	}
+	result, err := newSession(cfg, tokenCache).Token(session.Request{
+		ForceRefresh: forceRefresh,
+		// Never open a browser when kubectl reports a non-interactive session
+		NoLogin: !request.Interactive && !cfg.Headless,
+		BeforeLogin: func() {
+			if request.Cluster != nil {
+				fmt.Fprintf(os.Stderr, "Authentication required for cluster %s\n", request.Cluster.Server)
+			}
+		},
+	})
+	if errors.Is(err, session.ErrLoginRequired) {
+		return authError(fmt.Errorf("login required but kubectl is running non-interactively: run 'kubectl login' first"))
+	}
+	if err != nil {
+		return sessionError(err)
+	}
+	// A token that can't be cached is still good for this call
+	if result.SaveErr != nil {
+		warn(result.SaveErr)
+	}
+
+	// Write the response to stdout in the requested API version
+	return execcredential.WriteResponse(os.Stdout, request, result.Credential, credentialExpiry(result.Expiry, cfg.MinValidityDuration(), time.Now()))
+}
+
+// newSession creates the session that gets tokens for cfg, reporting waits
+// and warnings on stderr
+func newSession(cfg *config.Config, tokenCache *cache.TokenCache, opts ...session.Option) *session.Session {
+	opts = append([]session.Option{
+		session.WithWaitFunc(func() {
+			fmt.Fprintln(os.Stderr, "Waiting for another kubectl-login process to finish logging in...")
+		}),
+		session.WithWarnings(warn),
+	}, opts...)
+	return session.New(cfg, tokenCache, opts...)
+}
+
+// credentialExpiry returns the expiry reported to kubectl: the token's expiry
+// less the minimum validity, so that client-go runs the plugin again and gets a
+// refreshed token before the token lapses mid-stream. At most half of the
+// remaining lifetime is taken off, so that a token handed out close to its
+// expiry is still reused for a while.
+func credentialExpiry(expiry time.Time, minValidity time.Duration, now time.Time) time.Time {
+	margin := minValidity
+	if remaining := expiry.Sub(now); margin > remaining/2 {
+		margin = remaining / 2
+	}
+	if margin < 0 {
+		return expiry
+	}
+	return expiry.Add(-margin)
+}
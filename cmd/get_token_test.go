@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCredentialExpiry(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		expiry time.Time
+		want   time.Time
+	}{
+		{"long-lived token", now.Add(time.Hour), now.Add(50 * time.Minute)},
+		{"token close to expiry", now.Add(6 * time.Minute), now.Add(3 * time.Minute)},
+		{"expired token", now.Add(-time.Minute), now.Add(-time.Minute)},
+	}
+	for _, tt := range tests {
+		if got := credentialExpiry(tt.expiry, 10*time.Minute, now); !got.Equal(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got.Sub(now), tt.want.Sub(now))
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/auth"
+	"github.com/chinnareddy578/kubectl-login/pkg/cache"
+	"github.com/spf13/cobra"
+)
+
+var logoutGlobal bool
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Revoke cached tokens and remove them from the cache",
+	Long: `logout revokes the cached refresh and access tokens at the provider's
+revocation endpoint (RFC 7009) and removes them from the token cache, for
+every user logged in with the same settings. Tokens are removed even if
+revoking them fails.
+
+With --global, the browser is also opened at the provider's end session
+endpoint to sign out of the identity provider itself.`,
+	Args: cobra.NoArgs,
+	RunE: runLogout,
+}
+
+func init() {
+	logoutCmd.Flags().BoolVar(&logoutGlobal, "global", false, "Also end the session at the identity provider")
+	rootCmd.AddCommand(logoutCmd)
+}
+
+func runLogout(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd.Flags())
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	authenticator := auth.NewAuthenticator(cfg)
+	tokenCache, err := newTokenCache(cfg)
+	if err != nil {
+		return err
+	}
+	// The most recent login's ID token identifies the provider session
+	key := cache.NewKey(cfg)
+	_, cached := tokenCache.Find(key)
+
+	removed, revokeErr, err := revokeCached(authenticator, tokenCache, key)
+	if err != nil {
+		return cacheError(err)
+	}
+	if errors.Is(revokeErr, auth.ErrNotSupported) {
+		fmt.Fprintf(os.Stderr, "Warning: provider does not support token revocation, tokens remain valid until they expire\n")
+		revokeErr = nil
+	} else if revokeErr == nil && removed > 0 {
+		fmt.Println("Tokens revoked.")
+	}
+	if removed == 0 {
+		fmt.Println("No cached tokens found.")
+	} else {
+		fmt.Printf("Removed %d cached tokens.\n", removed)
+	}
+
+	if logoutGlobal {
+		idToken := ""
+		if cached != nil {
+			idToken = cached.IDToken
+		}
+
+		endSessionURL, err := authenticator.EndSessionURL(idToken)
+		if err != nil {
+			return fmt.Errorf("failed to end provider session: %w", err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Opening browser to end the provider session: %s\n", endSessionURL)
+		// loadConfig has validated the browser command
+		browserCommand, _ := cfg.BrowserCommandArgs()
+		if err := auth.OpenBrowser(browserCommand, endSessionURL); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to open browser: %v\n", err)
+		}
+	}
+
+	if revokeErr != nil {
+		return fmt.Errorf("token revocation failed: %w", revokeErr)
+	}
+
+	return nil
+}
+
+// revokeCached revokes the cached tokens of every user matching key and
+// removes them from the cache, even if revoking them failed, so that they are
+// not used again. It returns the number of tokens removed, the joined
+// revocation errors, and the error of a failed cache write, which stops it.
+func revokeCached(authenticator *auth.Authenticator, tokenCache *cache.TokenCache, key cache.Key) (removed int, revokeErr error, err error) {
+	var revokeErrs []error
+	for _, entry := range tokenCache.Entries() {
+		if !key.Matches(entry.Key) {
+			continue
+		}
+		if err := authenticator.Revoke(entry.Token); err != nil {
+			revokeErrs = append(revokeErrs, err)
+		}
+		if err := tokenCache.Clear(entry.Key); err != nil {
+			return removed, errors.Join(revokeErrs...), err
+		}
+		removed++
+	}
+	return removed, errors.Join(revokeErrs...), nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/auth"
+	"github.com/chinnareddy578/kubectl-login/pkg/cache"
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+func TestRevokeCached(t *testing.T) {
+	mockProvider := auth.NewMockOIDCProvider()
+	defer mockProvider.Close()
+	mockProvider.FailRevocation = map[string]bool{"refresh-alice": true}
+
+	cfg := &config.Config{IssuerURL: mockProvider.IssuerURL, ClientID: "client"}
+	other := &config.Config{IssuerURL: mockProvider.IssuerURL, ClientID: "other-client"}
+	tokenCache, _ := cache.NewTokenCache(cache.WithStore(cache.NewMemoryStore()))
+	for _, user := range []string{"alice", "bob"} {
+		tokenCache.Set(cache.NewKey(cfg).WithSubject(user), &types.TokenInfo{AccessToken: "access-" + user, RefreshToken: "refresh-" + user})
+	}
+	tokenCache.Set(cache.NewKey(other), &types.TokenInfo{AccessToken: "access-other"})
+
+	removed, revokeErr, err := revokeCached(auth.NewAuthenticator(cfg), tokenCache, cache.NewKey(cfg))
+	if err != nil {
+		t.Fatalf("revokeCached failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected the tokens of both users removed, got %d", removed)
+	}
+	if revokeErr == nil {
+		t.Error("expected the failed revocation to be reported")
+	}
+
+	// The access token is revoked even though its refresh token wasn't
+	revoked := map[string]bool{}
+	for _, token := range mockProvider.RevokedTokens {
+		revoked[token] = true
+	}
+	for _, token := range []string{"access-alice", "refresh-bob", "access-bob"} {
+		if !revoked[token] {
+			t.Errorf("expected %s to be revoked, got %v", token, mockProvider.RevokedTokens)
+		}
+	}
+
+	if entries := tokenCache.Entries(); len(entries) != 1 || entries[0].Key.ClientID != "other-client" {
+		t.Errorf("expected only the other client's token to remain, got %v", entries)
+	}
+}
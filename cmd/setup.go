@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+	"github.com/chinnareddy578/kubectl-login/pkg/kubeconfig"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	setupServer                   string
+	setupCertificateAuthority     string
+	setupCertificateAuthorityData string
+	setupInsecureSkipTLSVerify    bool
+	setupClusterName              string
+	setupUserName                 string
+	setupContextName              string
+	setupKubeconfig               string
+	setupExecCommand              string
+	setupSetCurrentContext        bool
+	setupDryRun                   bool
+)
+
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Add kubectl-login to your kubeconfig",
+	Long: `setup creates or updates the cluster, user and context entries in your
+kubeconfig so that kubectl authenticates through kubectl-login.
+
+The issuer, client and other login settings given to setup as flags or
+KUBECTL_LOGIN_* environment variables are written to the exec entry of the
+user. The client secret is not: kubectl reads it from KUBECTL_LOGIN_CLIENT_SECRET
+or the config file.`,
+	Example: `  kubectl login setup --server https://k8s.example.com --certificate-authority ca.crt \
+    --issuer-url https://sso.example.com --client-id kubernetes`,
+	Args: cobra.NoArgs,
+	RunE: runSetup,
+}
+
+func init() {
+	setupCmd.Flags().StringVar(&setupServer, "server", "", "Kubernetes API server URL (required)")
+	setupCmd.Flags().StringVar(&setupCertificateAuthority, "certificate-authority", "", "Path to the cluster CA certificate (embedded in the kubeconfig)")
+	setupCmd.Flags().StringVar(&setupCertificateAuthorityData, "certificate-authority-data", "", "Base64-encoded cluster CA certificate")
+	setupCmd.Flags().BoolVar(&setupInsecureSkipTLSVerify, "insecure-skip-tls-verify", false, "Skip verification of the API server certificate")
+	setupCmd.Flags().StringVar(&setupClusterName, "cluster-name", "", "Cluster entry name (default: server host name)")
+	setupCmd.Flags().StringVar(&setupUserName, "user-name", "", "User entry name (default: oidc-<cluster-name>)")
+	setupCmd.Flags().StringVar(&setupContextName, "context-name", "", "Context entry name (default: cluster name)")
+	setupCmd.Flags().StringVar(&setupKubeconfig, "kubeconfig", "", "Kubeconfig file to update (default: $KUBECONFIG or ~/.kube/config)")
+	setupCmd.Flags().StringVar(&setupExecCommand, "exec-command", "kubectl-login", "Command kubectl runs to get credentials")
+	setupCmd.Flags().BoolVar(&setupSetCurrentContext, "set-current-context", true, "Switch the current context to the new context")
+	setupCmd.Flags().BoolVar(&setupDryRun, "dry-run", false, "Print the kubeconfig changes as a diff without writing them")
+	setupCmd.MarkFlagRequired("server")
+
+	rootCmd.AddCommand(setupCmd)
+}
+
+func runSetup(cmd *cobra.Command, args []string) error {
+	serverURL, err := url.Parse(setupServer)
+	if err != nil || serverURL.Host == "" {
+		return fmt.Errorf("invalid server URL %q", setupServer)
+	}
+
+	opts := &kubeconfig.Options{
+		ClusterName:           setupClusterName,
+		Server:                setupServer,
+		InsecureSkipTLSVerify: setupInsecureSkipTLSVerify,
+		UserName:              setupUserName,
+		ContextName:           setupContextName,
+		Command:               setupExecCommand,
+		SetCurrentContext:     setupSetCurrentContext,
+	}
+	if opts.ClusterName == "" {
+		opts.ClusterName = serverURL.Hostname()
+	}
+	if opts.UserName == "" {
+		opts.UserName = "oidc-" + opts.ClusterName
+	}
+	if opts.ContextName == "" {
+		opts.ContextName = opts.ClusterName
+	}
+
+	// Check that the login settings of the new context are complete before
+	// writing them
+	loginCfg, err := loadConfigForProfile(cmd.Flags(), "", func() string { return opts.ContextName })
+	if err != nil {
+		return fmt.Errorf("invalid login settings: %w", err)
+	}
+
+	switch {
+	case setupCertificateAuthority != "" && setupCertificateAuthorityData != "":
+		return fmt.Errorf("--certificate-authority and --certificate-authority-data are mutually exclusive")
+	case setupInsecureSkipTLSVerify && (setupCertificateAuthority != "" || setupCertificateAuthorityData != ""):
+		return fmt.Errorf("--insecure-skip-tls-verify can't be used with a certificate authority")
+	case setupCertificateAuthority != "":
+		if opts.CertificateAuthorityData, err = os.ReadFile(setupCertificateAuthority); err != nil {
+			return fmt.Errorf("failed to read certificate authority: %w", err)
+		}
+	case setupCertificateAuthorityData != "":
+		if opts.CertificateAuthorityData, err = base64.StdEncoding.DecodeString(setupCertificateAuthorityData); err != nil {
+			return fmt.Errorf("invalid --certificate-authority-data: %w", err)
+		}
+	}
+
+	loginArgs, err := execArgs(cmd.Flags(), loginCfg, opts.ContextName)
+	if err != nil {
+		return err
+	}
+	if flags := cmd.Flags(); flags.Changed("client-secret") || os.Getenv(config.EnvPrefix+"CLIENT_SECRET") != "" || os.Getenv("CLIENT_SECRET") != "" {
+		warn(fmt.Errorf("the client secret is not written to the kubeconfig: provide it to kubectl with %sCLIENT_SECRET or the config file", config.EnvPrefix))
+	}
+	opts.Args = append([]string{"get-token"}, loginArgs...)
+
+	path := setupKubeconfig
+	if path == "" {
+		path = clientcmd.NewDefaultPathOptions().GetDefaultFilename()
+	}
+
+	cfg, err := kubeconfig.Load(path)
+	if err != nil {
+		return err
+	}
+	fromName := path
+	var before []byte
+	if _, err := os.Stat(path); err == nil {
+		if before, err = clientcmd.Write(*cfg); err != nil {
+			return fmt.Errorf("failed to serialize kubeconfig: %w", err)
+		}
+	} else {
+		fromName = "/dev/null"
+	}
+
+	if err := kubeconfig.Apply(cfg, opts); err != nil {
+		return err
+	}
+	after, err := clientcmd.Write(*cfg)
+	if err != nil {
+		return fmt.Errorf("failed to serialize kubeconfig: %w", err)
+	}
+
+	if setupDryRun {
+		diff := kubeconfig.Diff(fromName, path, string(before), string(after))
+		if diff == "" {
+			fmt.Fprintf(os.Stderr, "%s is already up to date\n", path)
+			return nil
+		}
+		fmt.Print(diff)
+		return nil
+	}
+
+	if err := clientcmd.WriteToFile(*cfg, path); err != nil {
+		return fmt.Errorf("failed to write kubeconfig: %w", err)
+	}
+
+	fmt.Printf("Updated %s: context %q uses cluster %q and user %q\n", path, opts.ContextName, opts.ClusterName, opts.UserName)
+	if cfg.CurrentContext == opts.ContextName {
+		fmt.Printf("Switched to context %q. Run 'kubectl get pods' to log in.\n", opts.ContextName)
+	}
+
+	return nil
+}
+
+// execArgs returns the login settings given as flags or KUBECTL_LOGIN_*
+// environment variables as exec plugin arguments, since neither is available
+// when kubectl runs the plugin. Settings from the config file are picked up
+// through --config. The client secret is left out, so that it doesn't end up
+// in the kubeconfig. File paths are made absolute since kubectl does not
+// expand them relative to the kubeconfig. Without --profile or --context,
+// --context names contextName, since get-token doesn't know which context
+// kubectl is using.
+func execArgs(flags *pflag.FlagSet, cfg *config.Config, contextName string) ([]string, error) {
+	var args []string
+	var err error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		// Only the login flags shared with the root command are passed on,
+		// and nothing after a path that failed to resolve
+		if err != nil || rootCmd.PersistentFlags().Lookup(flag.Name) == nil || flag.Name == "client-secret" {
+			return
+		}
+
+		value := flag.Value.String()
+		if !flags.Changed(flag.Name) {
+			env, ok := os.LookupEnv(config.EnvPrefix + envName(flag.Name))
+			if !ok || env == "" {
+				return
+			}
+			value = env
+		}
+
+		switch flag.Name {
+		case "config", "cache-key-file", "cache-dir":
+			abs, absErr := filepath.Abs(value)
+			if absErr != nil {
+				err = fmt.Errorf("failed to resolve --%s: %w", flag.Name, absErr)
+				return
+			}
+			value = abs
+		case "scopes":
+			value = strings.Join(cfg.Scopes, ",")
+		case "auth-param":
+			pairs := make([]string, 0, len(cfg.AuthParams))
+			for key, v := range cfg.AuthParams {
+				pairs = append(pairs, key+"="+v)
+			}
+			sort.Strings(pairs)
+			value = strings.Join(pairs, ",")
+		}
+		args = append(args, "--"+flag.Name+"="+value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if flagOrEnv(flags, "profile", profile) == "" && flagOrEnv(flags, "context", kubeContext) == "" {
+		args = append(args, "--context="+contextName)
+	}
+	return args, nil
+}
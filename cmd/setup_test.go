@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+)
+
+func TestExecArgs(t *testing.T) {
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("KUBECTL_LOGIN_ISSUER_URL", "https://env-issuer.com")
+	t.Setenv("KUBECTL_LOGIN_SCOPES", "openid groups")
+	t.Setenv("KUBECTL_LOGIN_CLIENT_SECRET", "env-secret")
+
+	flags := parseFlags(t, "--client-id", "flag-client", "--client-secret", "flag-secret", "--cache-dir", "cache")
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+
+	args, err := execArgs(flags, cfg, "prod-cluster")
+	if err != nil {
+		t.Fatalf("execArgs failed: %v", err)
+	}
+	cacheDir, _ := filepath.Abs("cache")
+	want := []string{
+		"--cache-dir=" + cacheDir,
+		"--client-id=flag-client",
+		"--issuer-url=https://env-issuer.com",
+		"--scopes=openid,groups",
+		"--context=prod-cluster",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("Expected flags and env settings without the client secret\nwant %q\n got %q", want, args)
+	}
+
+	// An explicit profile selects the settings instead of the context
+	t.Setenv("KUBECTL_LOGIN_PROFILE", "prod")
+	if args, err = execArgs(flags, cfg, "prod-cluster"); err != nil {
+		t.Fatalf("execArgs failed: %v", err)
+	}
+	if joined := strings.Join(args, " "); !strings.Contains(joined, "--profile=prod") || strings.Contains(joined, "--context") {
+		t.Errorf("Expected --profile instead of --context, got %q", args)
+	}
+}
+
+func TestExecArgs_UnresolvablePath(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("removing the working directory makes it unresolvable on linux only")
+	}
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	t.Setenv("PWD", "")
+	os.Remove(dir)
+
+	// A relative --cache-key-file can't be resolved, and the absolute --config
+	// resolved after it must not hide the error
+	flags := parseFlags(t, "--cache-key-file", "key", "--config", "/etc/kubectl-login/config.yaml")
+	if args, err := execArgs(flags, &config.Config{}, "ctx"); err == nil {
+		t.Errorf("expected an error for an unresolvable path, got %q", args)
+	}
+}
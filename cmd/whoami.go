@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/auth"
+	"github.com/chinnareddy578/kubectl-login/pkg/cache"
+	"github.com/spf13/cobra"
+)
+
+// expiryWarning is how close to expiry whoami starts warning
+const expiryWarning = 5 * time.Minute
+
+var whoamiOutput string
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the identity and groups of the cached ID token",
+	Long: `whoami decodes the cached ID token and shows who you are logged in as:
+subject, email, groups, audience, issuer, expiry and authentication time.`,
+	Args: cobra.NoArgs,
+	RunE: runWhoami,
+}
+
+func init() {
+	whoamiCmd.Flags().StringVarP(&whoamiOutput, "output", "o", "table", "Output format: table or json")
+	rootCmd.AddCommand(whoamiCmd)
+}
+
+func runWhoami(cmd *cobra.Command, args []string) error {
+	if whoamiOutput != "table" && whoamiOutput != "json" {
+		return fmt.Errorf("invalid output format %q: must be table or json", whoamiOutput)
+	}
+
+	cfg, err := loadConfig(cmd.Flags())
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	tokenCache, err := newTokenCache(cfg)
+	if err != nil {
+		return err
+	}
+	cached := tokenCache.Get(cache.NewKey(cfg))
+	if cached == nil {
+		return fmt.Errorf("not logged in to %s: run 'kubectl login' first", cfg.IssuerURL)
+	}
+	if cached.IDToken == "" {
+		return fmt.Errorf("cached token has no ID token: run 'kubectl login' again")
+	}
+
+	identity, err := auth.ParseIdentity(cached.IDToken)
+	if err != nil {
+		return fmt.Errorf("failed to decode ID token: %w", err)
+	}
+
+	if remaining := time.Until(identity.Expiry); remaining <= 0 {
+		fmt.Fprintf(os.Stderr, "Warning: ID token expired %v ago, it will be refreshed on the next kubectl call\n", -remaining.Round(time.Second))
+	} else if remaining < expiryWarning {
+		fmt.Fprintf(os.Stderr, "Warning: ID token expires in %v\n", remaining.Round(time.Second))
+	}
+
+	if whoamiOutput == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(identity)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Subject:\t%s\n", identity.Subject)
+	fmt.Fprintf(w, "Email:\t%s\n", identity.Email)
+	fmt.Fprintf(w, "Groups:\t%s\n", strings.Join(identity.Groups, ", "))
+	fmt.Fprintf(w, "Audience:\t%s\n", strings.Join(identity.Audience, ", "))
+	fmt.Fprintf(w, "Issuer:\t%s\n", identity.Issuer)
+	fmt.Fprintf(w, "Expires:\t%s\n", identity.Expiry.Local().Format(time.RFC3339))
+	if identity.AuthTime != nil {
+		fmt.Fprintf(w, "Authenticated:\t%s\n", identity.AuthTime.Local().Format(time.RFC3339))
+	}
+	return w.Flush()
+}
@@ -1,17 +1,23 @@
 package auth
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/chinnareddy578/kubectl-login/pkg/config"
@@ -22,18 +28,85 @@ import (
 
 // Authenticator handles OIDC authentication
 type Authenticator struct {
-	config *config.Config
-	ctx    context.Context
+	config     *config.Config
+	ctx        context.Context
+	browser    BrowserOpener
+	httpClient *http.Client
+	clock      Clock
 }
 
-// NewAuthenticator creates a new authenticator instance
-func NewAuthenticator(cfg *config.Config) *Authenticator {
-	return &Authenticator{
-		config: cfg,
-		ctx:    context.Background(),
+// BrowserOpener opens the authorization URL of the browser flow
+type BrowserOpener interface {
+	Open(url string) error
+}
+
+// BrowserOpenerFunc adapts a function to a BrowserOpener
+type BrowserOpenerFunc func(url string) error
+
+// Open calls f(url)
+func (f BrowserOpenerFunc) Open(url string) error {
+	return f(url)
+}
+
+// Clock tells the time and waits, for the login timeout and device flow polling
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock of the time package
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Option configures an Authenticator
+type Option func(*Authenticator)
+
+// WithBrowserOpener sets how the browser flow opens the authorization URL. The
+// default runs the configured browser command or the system browser.
+func WithBrowserOpener(browser BrowserOpener) Option {
+	return func(a *Authenticator) {
+		a.browser = browser
+	}
+}
+
+// WithHTTPClient sets the client for all requests to the provider, including
+// discovery and token requests. The default is http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(a *Authenticator) {
+		a.httpClient = client
+	}
+}
+
+// WithClock sets the clock. The default is the system clock.
+func WithClock(clock Clock) Option {
+	return func(a *Authenticator) {
+		a.clock = clock
 	}
 }
 
+// NewAuthenticator creates a new authenticator instance
+func NewAuthenticator(cfg *config.Config, opts ...Option) *Authenticator {
+	a := &Authenticator{
+		config:     cfg,
+		httpClient: http.DefaultClient,
+		clock:      systemClock{},
+	}
+	a.browser = BrowserOpenerFunc(a.openBrowser)
+	for _, opt := range opts {
+		opt(a)
+	}
+	// The oidc and oauth2 packages take the client from the context
+	a.ctx = oidc.ClientContext(context.Background(), a.httpClient)
+	return a
+}
+
 // Authenticate performs the authentication flow
 func (a *Authenticator) Authenticate() (*types.TokenInfo, error) {
 	// Perform new authentication
@@ -60,37 +133,25 @@ func (a *Authenticator) authenticateBrowser() (*types.TokenInfo, error) {
 		return nil, fmt.Errorf("failed to create OIDC provider: %w", err)
 	}
 
-	oidcConfig := &oidc.Config{
-		ClientID: a.config.ClientID,
-	}
-
-	verifier := provider.Verifier(oidcConfig)
-
-	redirectURL := fmt.Sprintf("http://localhost:%d/callback", a.config.Port)
-	oauth2Config := &oauth2.Config{
-		ClientID:     a.config.ClientID,
-		ClientSecret: a.config.ClientSecret,
-		Endpoint:     provider.Endpoint(),
-		RedirectURL:  redirectURL,
-		Scopes:       []string{oidc.ScopeOpenID, "profile", "email", "offline_access"},
-	}
+	verifier := a.idTokenVerifier(provider)
 
-	// Generate state and PKCE code verifier
-	state, err := generateRandomString(32)
+	req, err := newAuthRequest()
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate state: %w", err)
+		return nil, err
 	}
 
-	// Generate PKCE code verifier (43-128 characters, URL-safe)
-	codeVerifierBytes := make([]byte, 32)
-	if _, err := rand.Read(codeVerifierBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate code verifier: %w", err)
+	// Over SSH the browser runs on another machine and can't reach a callback server here
+	if manualLogin(a.config, os.Getenv) {
+		oauth2Config := a.oauth2Config(provider, manualRedirectURL(a.config))
+		return a.authenticateManual(oauth2Config, verifier, req, os.Stdin, os.Stderr)
 	}
-	codeVerifier := base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(codeVerifierBytes)
 
-	// Generate code challenge using S256 (SHA256)
-	codeChallengeBytes := sha256.Sum256([]byte(codeVerifier))
-	codeChallenge := base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(codeChallengeBytes[:])
+	// Listen before building the redirect URI, which names the port actually bound
+	listener, port, err := listenLoopback(a.config)
+	if err != nil {
+		return nil, err
+	}
+	oauth2Config := a.oauth2Config(provider, loopbackRedirectURL(port))
 
 	// Start local server for callback
 	codeChan := make(chan string, 1)
@@ -98,44 +159,22 @@ func (a *Authenticator) authenticateBrowser() (*types.TokenInfo, error) {
 
 	mux := http.NewServeMux()
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", a.config.Port),
 		Handler: mux,
 	}
 
 	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
 		// Log the callback for debugging
 		fmt.Fprintf(os.Stderr, "Callback received: %s %s\n", r.Method, r.URL.String())
-		
-		// Check for errors from OAuth provider
-		if errorParam := r.URL.Query().Get("error"); errorParam != "" {
-			errorDesc := r.URL.Query().Get("error_description")
-			errMsg := fmt.Sprintf("OAuth error: %s", errorParam)
-			if errorDesc != "" {
-				errMsg += fmt.Sprintf(" - %s", errorDesc)
-			}
-			errChan <- fmt.Errorf(errMsg)
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(fmt.Sprintf("Authentication failed: %s", errMsg)))
-			return
-		}
-
-		// Check state parameter
-		receivedState := r.URL.Query().Get("state")
-		if receivedState != state {
-			errChan <- fmt.Errorf("invalid state parameter: expected %s, got %s", state, receivedState)
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("Invalid state parameter"))
-			return
-		}
 
-		// Get authorization code
-		code := r.URL.Query().Get("code")
-		if code == "" {
-			// Log all query parameters for debugging
-			fmt.Fprintf(os.Stderr, "No code in callback. Query params: %v\n", r.URL.Query())
-			errChan <- fmt.Errorf("no authorization code received in callback")
+		code, err := callbackCode(r.URL.Query(), req.state)
+		if err != nil {
+			if r.URL.Query().Get("code") == "" && r.URL.Query().Get("error") == "" {
+				// Log all query parameters for debugging
+				fmt.Fprintf(os.Stderr, "No code in callback. Query params: %v\n", r.URL.Query())
+			}
+			errChan <- err
 			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("No authorization code received. Please try again."))
+			w.Write([]byte(fmt.Sprintf("Authentication failed: %v", err)))
 			return
 		}
 
@@ -145,73 +184,257 @@ func (a *Authenticator) authenticateBrowser() (*types.TokenInfo, error) {
 	})
 
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			errChan <- err
 		}
 	}()
 
-	// Build authorization URL with PKCE (S256 method)
-	authURL := oauth2Config.AuthCodeURL(state, 
-		oauth2.AccessTypeOffline, 
-		oauth2.SetAuthURLParam("code_challenge", codeChallenge),
-		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
-
-	// Open browser
-	if err := openBrowser(authURL); err != nil {
-		server.Close()
-		return nil, fmt.Errorf("failed to open browser: %w", err)
-	}
+	authURL := a.authCodeURL(oauth2Config, req)
 
 	fmt.Fprintf(os.Stderr, "Opening browser for authentication...\n")
 	fmt.Fprintf(os.Stderr, "If the browser doesn't open, visit: %s\n", authURL)
 
+	// The printed URL still works when the browser can't be launched, so keep waiting
+	if err := a.browser.Open(authURL); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to open browser: %v\n", err)
+	}
+
 	// Wait for callback
 	select {
 	case code := <-codeChan:
 		server.Close()
-		// Exchange code for token
-		token, err := oauth2Config.Exchange(a.ctx, code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
-		if err != nil {
-			return nil, fmt.Errorf("failed to exchange code for token: %w", err)
-		}
+		return a.exchangeCode(oauth2Config, verifier, req, code)
 
-		// Extract ID token
-		rawIDToken, ok := token.Extra("id_token").(string)
-		if !ok {
-			return nil, fmt.Errorf("no id_token in token response")
-		}
+	case err := <-errChan:
+		server.Close()
+		return nil, err
 
-		// Verify ID token
-		idToken, err := verifier.Verify(a.ctx, rawIDToken)
-		if err != nil {
-			return nil, fmt.Errorf("failed to verify ID token: %w", err)
-		}
+	case <-a.clock.After(config.LoginTimeout):
+		server.Close()
+		return nil, fmt.Errorf("authentication timeout")
+	}
+}
+
+// authenticateManual performs the authorization code flow without a callback
+// server: the user opens the authorization URL in any browser and pastes back
+// the URL it was redirected to, which fails to load, or just its code
+func (a *Authenticator) authenticateManual(oauth2Config *oauth2.Config, verifier *oidc.IDTokenVerifier, req *authRequest, in io.Reader, out io.Writer) (*types.TokenInfo, error) {
+	fmt.Fprintf(out, "Open this URL in a browser on your local machine:\n\n    %s\n\n", a.authCodeURL(oauth2Config, req))
+	fmt.Fprintf(out, "After logging in, the browser is redirected to %s, which fails to load.\n", oauth2Config.RedirectURL)
+	fmt.Fprintf(out, "Paste the full URL from the address bar, or the code parameter: ")
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, fmt.Errorf("failed to read the authorization code: %w", err)
+	}
+	code, err := pastedCode(strings.TrimSpace(line), req.state)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.exchangeCode(oauth2Config, verifier, req, code)
+}
 
-		// Extract user info
-		var claims struct {
-			Email string `json:"email"`
+// manualLogin reports whether to log in manually: when configured, or in an
+// SSH session without a display, where a browser would open on the wrong
+// machine, if at all
+func manualLogin(cfg *config.Config, getenv func(string) string) bool {
+	if cfg.Manual {
+		return true
+	}
+	return getenv("SSH_CONNECTION") != "" && getenv("DISPLAY") == "" && getenv("WAYLAND_DISPLAY") == ""
+}
+
+// manualRedirectURL returns the redirect URI of a manual login. Nothing listens
+// on it, but the provider must accept it, so it uses the first configured port.
+func manualRedirectURL(cfg *config.Config) string {
+	port := 8000
+	ports, _ := cfg.CallbackPorts()
+	for _, candidate := range ports {
+		if candidate != 0 {
+			port = candidate
+			break
 		}
-		if err := idToken.Claims(&claims); err != nil {
-			return nil, fmt.Errorf("failed to extract claims: %w", err)
+	}
+	return loopbackRedirectURL(port)
+}
+
+// loopbackRedirectURL returns the redirect URI for a callback on port. It names
+// the loopback IP rather than localhost, which may resolve to another address
+// or be remapped by the system (RFC 8252 section 8.3).
+func loopbackRedirectURL(port int) string {
+	return fmt.Sprintf("http://127.0.0.1:%d/callback", port)
+}
+
+// authRequest holds the state, nonce and PKCE parameters of an authorization request
+type authRequest struct {
+	state         string
+	nonce         string
+	codeVerifier  string
+	codeChallenge string
+}
+
+// newAuthRequest generates a random state, nonce and PKCE code verifier
+func newAuthRequest() (*authRequest, error) {
+	state, err := generateRandomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate state: %w", err)
+	}
+
+	// The provider echoes the nonce in the ID token, binding it to this request
+	nonce, err := generateRandomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	// Generate PKCE code verifier (43-128 characters, URL-safe)
+	codeVerifierBytes := make([]byte, 32)
+	if _, err := rand.Read(codeVerifierBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+	codeVerifier := base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(codeVerifierBytes)
+
+	// Generate code challenge using S256 (SHA256)
+	codeChallengeBytes := sha256.Sum256([]byte(codeVerifier))
+	codeChallenge := base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(codeChallengeBytes[:])
+
+	return &authRequest{state: state, nonce: nonce, codeVerifier: codeVerifier, codeChallenge: codeChallenge}, nil
+}
+
+// oauth2Config returns the authorization code flow configuration for redirectURL
+func (a *Authenticator) oauth2Config(provider *oidc.Provider, redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     a.config.ClientID,
+		ClientSecret: a.config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       a.scopes(),
+	}
+}
+
+// authCodeURL builds the authorization URL with PKCE (S256 method)
+func (a *Authenticator) authCodeURL(oauth2Config *oauth2.Config, req *authRequest) string {
+	authOptions := []oauth2.AuthCodeOption{
+		oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("code_challenge", req.codeChallenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		oidc.Nonce(req.nonce),
+	}
+	for key, value := range a.authParams() {
+		authOptions = append(authOptions, oauth2.SetAuthURLParam(key, value))
+	}
+	return oauth2Config.AuthCodeURL(req.state, authOptions...)
+}
+
+// callbackCode returns the authorization code of a redirect to the callback,
+// checking the error and state parameters
+func callbackCode(query url.Values, state string) (string, error) {
+	// Check for errors from OAuth provider
+	if errorParam := query.Get("error"); errorParam != "" {
+		errMsg := fmt.Sprintf("OAuth error: %s", errorParam)
+		if errorDesc := query.Get("error_description"); errorDesc != "" {
+			errMsg += fmt.Sprintf(" - %s", errorDesc)
 		}
+		return "", errors.New(errMsg)
+	}
 
-		fmt.Fprintf(os.Stderr, "Successfully authenticated as: %s\n", claims.Email)
+	// Check state parameter
+	if receivedState := query.Get("state"); receivedState != state {
+		return "", fmt.Errorf("invalid state parameter: expected %s, got %s", state, receivedState)
+	}
 
-		return &types.TokenInfo{
-			AccessToken:  token.AccessToken,
-			RefreshToken: token.RefreshToken,
-			IDToken:      rawIDToken,
-			Expiry:       token.Expiry,
-		}, nil
+	// Get authorization code
+	code := query.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("no authorization code received in callback")
+	}
+	return code, nil
+}
 
-	case err := <-errChan:
-		server.Close()
-		return nil, err
+// pastedCode returns the authorization code from a pasted redirect URL, or
+// its query, checking the state like the callback does. Input without
+// parameters is taken as the code itself, which PKCE still binds to this login.
+func pastedCode(input, state string) (string, error) {
+	if input == "" {
+		return "", fmt.Errorf("no authorization code entered")
+	}
 
-	case <-time.After(5 * time.Minute):
-		server.Close()
-		return nil, fmt.Errorf("authentication timeout")
+	query := input
+	if _, after, found := strings.Cut(input, "?"); found {
+		query = after
+	}
+	query, _, _ = strings.Cut(query, "#")
+	if !strings.Contains(query, "=") {
+		return input, nil
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the pasted URL: %w", err)
+	}
+	return callbackCode(values, state)
+}
+
+// exchangeCode exchanges an authorization code for tokens and verifies the ID token
+func (a *Authenticator) exchangeCode(oauth2Config *oauth2.Config, verifier *oidc.IDTokenVerifier, req *authRequest, code string) (*types.TokenInfo, error) {
+	token, err := oauth2Config.Exchange(a.ctx, code, oauth2.SetAuthURLParam("code_verifier", req.codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code for token: %w", err)
 	}
+
+	// Extract ID token
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("no id_token in token response")
+	}
+
+	// Verify ID token
+	idToken, err := verifier.Verify(a.ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify ID token: %w", err)
+	}
+	if idToken.Nonce != req.nonce {
+		return nil, fmt.Errorf("failed to verify ID token: nonce does not match the authorization request")
+	}
+
+	// Extract user info
+	var claims struct {
+		Email string `json:"email"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to extract claims: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Successfully authenticated as: %s\n", claims.Email)
+
+	return &types.TokenInfo{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		IDToken:      rawIDToken,
+		Expiry:       token.Expiry,
+	}, nil
+}
+
+// listenLoopback listens for the OAuth callback on the loopback interface only,
+// so that other hosts on the network can't reach it. The configured ports are
+// tried in order; port 0 lets the OS pick a free one. It returns the listener
+// and the port bound.
+func listenLoopback(cfg *config.Config) (net.Listener, int, error) {
+	ports, err := cfg.CallbackPorts()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var lastErr error
+	for _, port := range ports {
+		listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return listener, listener.Addr().(*net.TCPAddr).Port, nil
+	}
+	return nil, 0, fmt.Errorf("failed to listen for the OAuth callback on port %s: %w (use --port to pick other ports, or --port auto)", cfg.Port, lastErr)
 }
 
 // authenticateHeadless performs headless authentication (for CI/CD)
@@ -221,94 +444,246 @@ func (a *Authenticator) authenticateHeadless() (*types.TokenInfo, error) {
 		return nil, fmt.Errorf("failed to create OIDC provider: %w", err)
 	}
 
-	oidcConfig := &oidc.Config{
-		ClientID: a.config.ClientID,
-	}
-
-	verifier := provider.Verifier(oidcConfig)
+	verifier := a.idTokenVerifier(provider)
 
 	oauth2Config := &oauth2.Config{
 		ClientID:     a.config.ClientID,
 		ClientSecret: a.config.ClientSecret,
 		Endpoint:     provider.Endpoint(),
-		Scopes:       []string{oidc.ScopeOpenID, "profile", "email", "offline_access"},
+		Scopes:       a.scopes(),
 	}
 
 	// For headless mode, try client credentials first if secret is available
-	// Otherwise, attempt device flow
+	// Otherwise, attempt the device flow advertised in the discovery document
 	if a.config.ClientSecret != "" {
 		// Try client credentials flow
-		if token, err := a.clientCredentialsFlow(oauth2Config); err == nil {
+		token, err := a.clientCredentialsFlow(oauth2Config, verifier)
+		if err == nil {
 			return token, nil
 		}
-		fmt.Fprintf(os.Stderr, "Client credentials flow failed, trying device flow...\n")
+		fmt.Fprintf(os.Stderr, "Client credentials flow failed (%v), trying device flow...\n", err)
 	}
 
-	// Try device flow (endpoints may vary by provider)
-	// Common device flow endpoints
-	deviceEndpoints := []string{
-		a.config.IssuerURL + "/device",
-		a.config.IssuerURL + "/oauth2/device",
-		a.config.IssuerURL + "/v1/device",
+	var meta providerMetadata
+	if err := provider.Claims(&meta); err != nil {
+		return nil, fmt.Errorf("failed to read provider metadata: %w", err)
+	}
+	if meta.DeviceAuthorizationEndpoint == "" {
+		return nil, fmt.Errorf("headless authentication failed: provider does not advertise a device_authorization_endpoint and client credentials are not available")
+	}
+	if meta.TokenEndpoint == "" {
+		meta.TokenEndpoint = oauth2Config.Endpoint.TokenURL
 	}
 
-	for _, deviceAuthURL := range deviceEndpoints {
-		if token, err := a.deviceFlow(deviceAuthURL, oauth2Config, verifier); err == nil {
-			return token, nil
+	return a.deviceFlow(&meta, verifier)
+}
+
+// providerMetadata holds discovery document fields that oidc.Provider does not expose directly
+type providerMetadata struct {
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	RevocationEndpoint          string `json:"revocation_endpoint"`
+	EndSessionEndpoint          string `json:"end_session_endpoint"`
+}
+
+// ErrNotSupported is returned when the provider does not advertise an endpoint
+var ErrNotSupported = errors.New("not supported by the provider")
+
+// IsInvalidGrant reports whether err is the token endpoint rejecting a grant,
+// such as an expired or revoked refresh token
+func IsInvalidGrant(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	return errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant"
+}
+
+// metadata fetches the provider discovery document
+func (a *Authenticator) metadata() (*providerMetadata, error) {
+	provider, err := oidc.NewProvider(a.ctx, a.config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OIDC provider: %w", err)
+	}
+
+	var meta providerMetadata
+	if err := provider.Claims(&meta); err != nil {
+		return nil, fmt.Errorf("failed to read provider metadata: %w", err)
+	}
+
+	return &meta, nil
+}
+
+// Revoke revokes the refresh and access tokens at the provider's
+// revocation_endpoint (RFC 7009). Both are tried even if one fails, and the
+// errors are joined. It returns an error wrapping ErrNotSupported if the
+// provider does not advertise one.
+func (a *Authenticator) Revoke(token *types.TokenInfo) error {
+	meta, err := a.metadata()
+	if err != nil {
+		return err
+	}
+	if meta.RevocationEndpoint == "" {
+		return fmt.Errorf("token revocation: %w", ErrNotSupported)
+	}
+
+	// Revoking the refresh token first also invalidates its access tokens at most providers
+	var errs []error
+	if token.RefreshToken != "" {
+		if err := a.revoke(meta.RevocationEndpoint, token.RefreshToken, "refresh_token"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if token.AccessToken != "" {
+		if err := a.revoke(meta.RevocationEndpoint, token.AccessToken, "access_token"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// revoke sends a single token revocation request
+func (a *Authenticator) revoke(endpoint, token, tokenTypeHint string) error {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {tokenTypeHint},
+	}
+	// Public clients identify themselves, confidential clients authenticate with HTTP Basic
+	if a.config.ClientSecret == "" {
+		form.Set("client_id", a.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(a.ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create revocation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if a.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(a.config.ClientID), url.QueryEscape(a.config.ClientSecret))
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke %s: %w", tokenTypeHint, err)
+	}
+	defer resp.Body.Close()
+
+	// The provider responds 200 for both revoked and unknown tokens
+	if resp.StatusCode != http.StatusOK {
+		var errResp tokenErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Error != "" {
+			return fmt.Errorf("failed to revoke %s: %s", tokenTypeHint, errResp)
 		}
+		return fmt.Errorf("failed to revoke %s: status %d", tokenTypeHint, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// EndSessionURL returns the provider's end_session_endpoint URL (OpenID Connect
+// RP-Initiated Logout) with the ID token as hint. It returns an error wrapping
+// ErrNotSupported if the provider does not advertise one.
+func (a *Authenticator) EndSessionURL(idToken string) (string, error) {
+	meta, err := a.metadata()
+	if err != nil {
+		return "", err
+	}
+	if meta.EndSessionEndpoint == "" {
+		return "", fmt.Errorf("end session: %w", ErrNotSupported)
 	}
 
-	return nil, fmt.Errorf("headless authentication failed: device flow not supported or client credentials invalid. Please use browser mode or configure device flow endpoints")
+	endSessionURL, err := url.Parse(meta.EndSessionEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid end_session_endpoint: %w", err)
+	}
+
+	query := endSessionURL.Query()
+	query.Set("client_id", a.config.ClientID)
+	if idToken != "" {
+		query.Set("id_token_hint", idToken)
+	}
+	endSessionURL.RawQuery = query.Encode()
+
+	return endSessionURL.String(), nil
+}
+
+// deviceAuthResponse is the device authorization response (RFC 8628 section 3.2)
+type deviceAuthResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	Interval                int    `json:"interval"`
+	ExpiresIn               int    `json:"expires_in"`
+}
+
+// tokenErrorResponse is an OAuth2 error response (RFC 6749 section 5.2)
+type tokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
 }
 
-// deviceFlow implements OAuth2 device flow for headless authentication
-func (a *Authenticator) deviceFlow(deviceAuthURL string, oauth2Config *oauth2.Config, verifier *oidc.IDTokenVerifier) (*types.TokenInfo, error) {
+// deviceFlow implements the OAuth2 device authorization grant (RFC 8628)
+func (a *Authenticator) deviceFlow(meta *providerMetadata, verifier *oidc.IDTokenVerifier) (*types.TokenInfo, error) {
 	// Request device code
-	resp, err := http.PostForm(deviceAuthURL, url.Values{
+	form := url.Values{
 		"client_id": {a.config.ClientID},
-		"scope":     {"openid profile email offline_access"},
-	})
+		"scope":     {strings.Join(a.scopes(), " ")},
+	}
+	if a.config.ClientSecret != "" {
+		form.Set("client_secret", a.config.ClientSecret)
+	}
+	a.addAuthParams(form)
+	resp, err := a.httpClient.PostForm(meta.DeviceAuthorizationEndpoint, form)
 	if err != nil {
 		return nil, fmt.Errorf("failed to request device code: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		var errResp tokenErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Error != "" {
+			return nil, fmt.Errorf("device code request failed: %s", errResp)
+		}
 		return nil, fmt.Errorf("device code request failed with status %d", resp.StatusCode)
 	}
 
-	var deviceResp struct {
-		DeviceCode      string `json:"device_code"`
-		UserCode        string `json:"user_code"`
-		VerificationURI string `json:"verification_uri"`
-		Interval        int    `json:"interval"`
-		ExpiresIn       int    `json:"expires_in"`
-	}
-
+	var deviceResp deviceAuthResponse
 	if err := json.NewDecoder(resp.Body).Decode(&deviceResp); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to decode device code response: %w", err)
 	}
 
-	fmt.Fprintf(os.Stderr, "Please visit: %s\n", deviceResp.VerificationURI)
-	fmt.Fprintf(os.Stderr, "Enter code: %s\n", deviceResp.UserCode)
+	if deviceResp.VerificationURIComplete != "" {
+		fmt.Fprintf(os.Stderr, "Please visit: %s\n", deviceResp.VerificationURIComplete)
+		fmt.Fprintf(os.Stderr, "Or visit %s and enter code: %s\n", deviceResp.VerificationURI, deviceResp.UserCode)
+	} else {
+		fmt.Fprintf(os.Stderr, "Please visit: %s\n", deviceResp.VerificationURI)
+		fmt.Fprintf(os.Stderr, "Enter code: %s\n", deviceResp.UserCode)
+	}
 
 	// Poll for token
-	tokenURL := a.config.IssuerURL + "/token"
 	interval := time.Duration(deviceResp.Interval) * time.Second
 	if interval == 0 {
 		interval = 5 * time.Second
 	}
 
-	expiresAt := time.Now().Add(time.Duration(deviceResp.ExpiresIn) * time.Second)
+	expiresIn := time.Duration(deviceResp.ExpiresIn) * time.Second
+	if expiresIn == 0 {
+		expiresIn = 5 * time.Minute
+	}
+	expiresAt := a.clock.Now().Add(expiresIn)
+
+	form = url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {deviceResp.DeviceCode},
+		"client_id":   {a.config.ClientID},
+	}
+	if a.config.ClientSecret != "" {
+		form.Set("client_secret", a.config.ClientSecret)
+	}
 
-	for time.Now().Before(expiresAt) {
-		time.Sleep(interval)
+	for a.clock.Now().Before(expiresAt) {
+		<-a.clock.After(interval)
 
-		resp, err := http.PostForm(tokenURL, url.Values{
-			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
-			"device_code": {deviceResp.DeviceCode},
-			"client_id":   {a.config.ClientID},
-		})
+		resp, err := a.httpClient.PostForm(meta.TokenEndpoint, form)
 		if err != nil {
 			continue
 		}
@@ -321,11 +696,11 @@ func (a *Authenticator) deviceFlow(deviceAuthURL string, oauth2Config *oauth2.Co
 				ExpiresIn    int    `json:"expires_in"`
 			}
 
-			if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-				resp.Body.Close()
-				continue
-			}
+			err := json.NewDecoder(resp.Body).Decode(&tokenResp)
 			resp.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode token response: %w", err)
+			}
 
 			// Verify ID token
 			idToken, err := verifier.Verify(a.ctx, tokenResp.IDToken)
@@ -346,18 +721,46 @@ func (a *Authenticator) deviceFlow(deviceAuthURL string, oauth2Config *oauth2.Co
 				AccessToken:  tokenResp.AccessToken,
 				RefreshToken: tokenResp.RefreshToken,
 				IDToken:      tokenResp.IDToken,
-				Expiry:       time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+				Expiry:       a.clock.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
 			}, nil
 		}
 
+		var errResp tokenErrorResponse
+		err = json.NewDecoder(resp.Body).Decode(&errResp)
 		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("device token request failed with status %d", resp.StatusCode)
+		}
+
+		switch errResp.Error {
+		case "authorization_pending":
+			// User has not completed the authorization yet
+		case "slow_down":
+			interval += 5 * time.Second
+		case "access_denied":
+			return nil, fmt.Errorf("device authorization denied by user")
+		case "expired_token":
+			return nil, fmt.Errorf("device code expired before authorization completed")
+		default:
+			return nil, fmt.Errorf("device token request failed: %s", errResp)
+		}
 	}
 
 	return nil, fmt.Errorf("device flow authentication timeout")
 }
 
-// clientCredentialsFlow implements OAuth2 client credentials flow
-func (a *Authenticator) clientCredentialsFlow(oauth2Config *oauth2.Config) (*types.TokenInfo, error) {
+// String formats the error code and optional description
+func (e tokenErrorResponse) String() string {
+	if e.ErrorDescription != "" {
+		return e.Error + " - " + e.ErrorDescription
+	}
+	return e.Error
+}
+
+// clientCredentialsFlow implements OAuth2 client credentials flow. Most
+// providers return no ID token for this grant, in which case it fails unless
+// the access token is the configured token type.
+func (a *Authenticator) clientCredentialsFlow(oauth2Config *oauth2.Config, verifier *oidc.IDTokenVerifier) (*types.TokenInfo, error) {
 	// Client credentials flow requires a custom token endpoint request
 	// since oauth2.Config doesn't directly support client credentials grant
 	tokenURL := oauth2Config.Endpoint.TokenURL
@@ -366,12 +769,14 @@ func (a *Authenticator) clientCredentialsFlow(oauth2Config *oauth2.Config) (*typ
 	}
 
 	// Make client credentials request
-	resp, err := http.PostForm(tokenURL, url.Values{
+	form := url.Values{
 		"grant_type":    {"client_credentials"},
 		"client_id":     {a.config.ClientID},
 		"client_secret": {a.config.ClientSecret},
-		"scope":         {"openid profile email"},
-	})
+		"scope":         {strings.Join(a.scopes(), " ")},
+	}
+	a.addAuthParams(form)
+	resp, err := a.httpClient.PostForm(tokenURL, form)
 	if err != nil {
 		return nil, fmt.Errorf("client credentials request failed: %w", err)
 	}
@@ -383,6 +788,7 @@ func (a *Authenticator) clientCredentialsFlow(oauth2Config *oauth2.Config) (*typ
 
 	var tokenResp struct {
 		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
 		TokenType   string `json:"token_type"`
 		ExpiresIn   int    `json:"expires_in"`
 	}
@@ -391,21 +797,34 @@ func (a *Authenticator) clientCredentialsFlow(oauth2Config *oauth2.Config) (*typ
 		return nil, fmt.Errorf("failed to decode token response: %w", err)
 	}
 
-	expiry := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	if tokenResp.IDToken != "" {
+		if _, err := verifier.Verify(a.ctx, tokenResp.IDToken); err != nil {
+			return nil, fmt.Errorf("failed to verify ID token: %w", err)
+		}
+	} else if a.config.TokenType != config.TokenTypeAccessToken {
+		return nil, fmt.Errorf("the provider returned no ID token for client credentials (set token_type to access_token to use the access token)")
+	}
+
+	expiry := a.clock.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
 
 	return &types.TokenInfo{
 		AccessToken: tokenResp.AccessToken,
+		IDToken:     tokenResp.IDToken,
 		Expiry:      expiry,
 	}, nil
 }
 
-// RefreshToken refreshes an expired token
-func (a *Authenticator) RefreshToken(refreshToken string) (*types.TokenInfo, error) {
+// RefreshToken refreshes an expired token. The ID token returned by the provider
+// is verified; if the provider does not return one, the previous ID token is kept
+// only while it is still valid. The previous refresh token is kept unless rotated.
+func (a *Authenticator) RefreshToken(previous *types.TokenInfo) (*types.TokenInfo, error) {
 	provider, err := oidc.NewProvider(a.ctx, a.config.IssuerURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OIDC provider: %w", err)
 	}
 
+	verifier := a.idTokenVerifier(provider)
+
 	oauth2Config := &oauth2.Config{
 		ClientID:     a.config.ClientID,
 		ClientSecret: a.config.ClientSecret,
@@ -413,7 +832,7 @@ func (a *Authenticator) RefreshToken(refreshToken string) (*types.TokenInfo, err
 	}
 
 	token := &oauth2.Token{
-		RefreshToken: refreshToken,
+		RefreshToken: previous.RefreshToken,
 	}
 
 	newToken, err := oauth2Config.TokenSource(a.ctx, token).Token()
@@ -421,11 +840,67 @@ func (a *Authenticator) RefreshToken(refreshToken string) (*types.TokenInfo, err
 		return nil, fmt.Errorf("failed to refresh token: %w", err)
 	}
 
-	return &types.TokenInfo{
+	refreshed := &types.TokenInfo{
 		AccessToken:  newToken.AccessToken,
 		RefreshToken: newToken.RefreshToken,
 		Expiry:       newToken.Expiry,
-	}, nil
+	}
+
+	// Providers that do not rotate refresh tokens omit them from the response
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = previous.RefreshToken
+	}
+
+	if rawIDToken, ok := newToken.Extra("id_token").(string); ok && rawIDToken != "" {
+		if _, err := verifier.Verify(a.ctx, rawIDToken); err != nil {
+			return nil, fmt.Errorf("failed to verify refreshed ID token: %w", err)
+		}
+		refreshed.IDToken = rawIDToken
+	} else if previous.IDToken != "" {
+		// Keep the previous ID token only if it is still valid
+		if _, err := verifier.Verify(a.ctx, previous.IDToken); err == nil {
+			refreshed.IDToken = previous.IDToken
+		}
+	}
+
+	return refreshed, nil
+}
+
+// idTokenVerifier returns a verifier of ID tokens issued by provider to the
+// configured client, checking their expiry against the authenticator's clock
+func (a *Authenticator) idTokenVerifier(provider *oidc.Provider) *oidc.IDTokenVerifier {
+	return provider.Verifier(&oidc.Config{
+		ClientID: a.config.ClientID,
+		Now:      a.clock.Now,
+	})
+}
+
+// scopes returns the configured scopes, or the default OIDC scopes
+func (a *Authenticator) scopes() []string {
+	if len(a.config.Scopes) > 0 {
+		return a.config.Scopes
+	}
+	return config.DefaultScopes
+}
+
+// addAuthParams adds the configured extra authorization parameters to form
+func (a *Authenticator) addAuthParams(form url.Values) {
+	for key, value := range a.authParams() {
+		form.Set(key, value)
+	}
+}
+
+// authParams returns the configured extra authorization parameters, including
+// the login hint
+func (a *Authenticator) authParams() map[string]string {
+	if a.config.LoginHint == "" {
+		return a.config.AuthParams
+	}
+	params := map[string]string{"login_hint": a.config.LoginHint}
+	for key, value := range a.config.AuthParams {
+		params[key] = value
+	}
+	return params
 }
 
 // generateRandomString generates a random string for state and PKCE
@@ -437,18 +912,31 @@ func generateRandomString(length int) (string, error) {
 	return base64.URLEncoding.EncodeToString(b)[:length], nil
 }
 
-// openBrowser opens the default browser with the given URL
-func openBrowser(url string) error {
+// OpenBrowser opens url with command, which gets the URL as last argument, or
+// with the default browser if command is empty
+func OpenBrowser(command []string, url string) error {
 	var cmd *exec.Cmd
-	switch runtime.GOOS {
-	case "windows":
+	switch {
+	case len(command) > 0:
+		args := append(append([]string(nil), command[1:]...), url)
+		cmd = exec.Command(command[0], args...)
+	case runtime.GOOS == "windows":
 		cmd = exec.Command("cmd", "/c", "start", url)
-	case "darwin":
+	case runtime.GOOS == "darwin":
 		cmd = exec.Command("open", url)
-	case "linux":
+	case runtime.GOOS == "linux":
 		cmd = exec.Command("xdg-open", url)
 	default:
 		return fmt.Errorf("unsupported platform")
 	}
 	return cmd.Start()
 }
+
+// openBrowser opens url with the configured browser command
+func (a *Authenticator) openBrowser(url string) error {
+	command, err := a.config.BrowserCommandArgs()
+	if err != nil {
+		return err
+	}
+	return OpenBrowser(command, url)
+}
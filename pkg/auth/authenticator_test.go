@@ -1,11 +1,27 @@
 package auth
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/chinnareddy578/kubectl-login/pkg/config"
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
 )
 
 func TestAuthenticator_RefreshToken(t *testing.T) {
@@ -17,7 +33,7 @@ func TestAuthenticator_RefreshToken(t *testing.T) {
 		ClientID:     "test-client-id",
 		ClientSecret: "test-client-secret",
 		Headless:     false,
-		Port:         8000,
+		Port:         "8000",
 	}
 
 	authenticator := NewAuthenticator(cfg)
@@ -32,15 +48,310 @@ func TestAuthenticator_RefreshToken(t *testing.T) {
 		TokenType:    "Bearer",
 	}
 
-	// Note: This test may fail if the OIDC provider verification is strict
-	// In a real scenario, you'd need a properly signed JWT
-	// For now, we'll test the error handling
-	token, err := authenticator.RefreshToken(refreshToken)
+	token, err := authenticator.RefreshToken(&types.TokenInfo{RefreshToken: refreshToken})
 	if err != nil {
-		// Expected if ID token verification fails
-		t.Logf("Refresh token test (expected to fail with mock): %v", err)
-	} else if token != nil {
-		t.Logf("Refresh token successful: %+v", token)
+		t.Fatalf("RefreshToken failed: %v", err)
+	}
+	if token.AccessToken != "refreshed-access-token" {
+		t.Errorf("Expected refreshed access token, got '%s'", token.AccessToken)
+	}
+	if identity, err := ParseIdentity(token.IDToken); err != nil || identity.Subject != "test-user-123" {
+		t.Errorf("Expected the refreshed ID token of the mock user, got %+v, %v", identity, err)
+	}
+}
+
+func TestAuthenticator_RefreshTokenWithoutIDToken(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	mockProvider.OmitRefreshIDToken = true
+	mockProvider.OmitRefreshToken = true
+
+	cfg := &config.Config{
+		IssuerURL: mockProvider.IssuerURL,
+		ClientID:  "test-client-id",
+	}
+
+	refreshToken := "mock-refresh-token-test"
+	mockProvider.Tokens["test-code"] = &MockToken{
+		AccessToken:  "old-access-token",
+		RefreshToken: refreshToken,
+		ExpiresIn:    3600,
+		TokenType:    "Bearer",
+	}
+
+	previous := &types.TokenInfo{
+		AccessToken:  "old-access-token",
+		RefreshToken: refreshToken,
+		// Not a valid ID token, so it must not be carried over
+		IDToken: "old-id-token",
+	}
+
+	token, err := NewAuthenticator(cfg).RefreshToken(previous)
+	if err != nil {
+		t.Fatalf("RefreshToken failed: %v", err)
+	}
+
+	if token.AccessToken != "refreshed-access-token" {
+		t.Errorf("Expected refreshed access token, got '%s'", token.AccessToken)
+	}
+	if token.RefreshToken != refreshToken {
+		t.Errorf("Expected previous refresh token to be kept, got '%s'", token.RefreshToken)
+	}
+	if token.IDToken != "" {
+		t.Errorf("Expected invalid previous ID token to be dropped, got '%s'", token.IDToken)
+	}
+}
+
+func TestAuthenticator_RefreshTokenUsesClock(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	mockProvider.OmitRefreshIDToken = true
+	mockProvider.OmitRefreshToken = true
+	mockProvider.Tokens["test-code"] = &MockToken{
+		AccessToken:  "old-access-token",
+		RefreshToken: "mock-refresh-token-test",
+		ExpiresIn:    3600,
+		TokenType:    "Bearer",
+	}
+
+	cfg := &config.Config{
+		IssuerURL: mockProvider.IssuerURL,
+		ClientID:  "test-client-id",
+	}
+	previous := &types.TokenInfo{
+		RefreshToken: "mock-refresh-token-test",
+		// Valid for an hour
+		IDToken: mockIDToken(t, mockProvider, ""),
+	}
+
+	token, err := NewAuthenticator(cfg, WithClock(&fakeClock{now: time.Now()})).RefreshToken(previous)
+	if err != nil {
+		t.Fatalf("RefreshToken failed: %v", err)
+	}
+	if token.IDToken != previous.IDToken {
+		t.Error("Expected the previous ID token to be kept while it is valid")
+	}
+
+	// Two hours later by the injected clock, the previous ID token has expired
+	later := &fakeClock{now: time.Now().Add(2 * time.Hour)}
+	token, err = NewAuthenticator(cfg, WithClock(later)).RefreshToken(previous)
+	if err != nil {
+		t.Fatalf("RefreshToken failed: %v", err)
+	}
+	if token.IDToken != "" {
+		t.Error("Expected the previous ID token to be dropped once expired by the injected clock")
+	}
+}
+
+func TestAuthenticator_ClientCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		tokenType   string
+		withIDToken bool
+		wantAccess  string
+		wantDevice  bool
+	}{
+		// Without an ID token, an ID token login falls back to the device flow
+		{"id_token without ID token", config.TokenTypeIDToken, false, "mock-access-token-mock-device-code", true},
+		{"id_token with ID token", config.TokenTypeIDToken, true, "client-credentials-access-token", false},
+		{"access_token", config.TokenTypeAccessToken, false, "client-credentials-access-token", false},
+	}
+	for _, tt := range tests {
+		mockProvider := NewMockOIDCProvider()
+		mockProvider.ClientCredentialsIDToken = tt.withIDToken
+
+		cfg := &config.Config{
+			IssuerURL:    mockProvider.IssuerURL,
+			ClientID:     "test-client-id",
+			ClientSecret: "test-client-secret",
+			Headless:     true,
+			TokenType:    tt.tokenType,
+		}
+		token, err := NewAuthenticator(cfg, WithClock(&fakeClock{now: time.Now()})).Authenticate()
+		mockProvider.Close()
+		if err != nil {
+			t.Errorf("%s: Authenticate failed: %v", tt.name, err)
+			continue
+		}
+		if !strings.HasPrefix(token.AccessToken, tt.wantAccess) {
+			t.Errorf("%s: Expected access token %s, got %s", tt.name, tt.wantAccess, token.AccessToken)
+		}
+		if used := len(mockProvider.DeviceRequests) > 0; used != tt.wantDevice {
+			t.Errorf("%s: Expected device flow %v, got %v", tt.name, tt.wantDevice, used)
+		}
+		if _, _, err := CredentialToken(token, tt.tokenType); err != nil {
+			t.Errorf("%s: Expected a %s credential, got %v", tt.name, tt.tokenType, err)
+		}
+	}
+}
+
+func TestAuthenticator_ClientCredentialsScopes(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	cfg := &config.Config{
+		IssuerURL:    mockProvider.IssuerURL,
+		ClientID:     "test-client-id",
+		ClientSecret: "test-client-secret",
+		Headless:     true,
+		TokenType:    config.TokenTypeAccessToken,
+		Scopes:       []string{"openid", "api"},
+	}
+	if _, err := NewAuthenticator(cfg).Authenticate(); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if len(mockProvider.ClientCredentialsRequests) != 1 {
+		t.Fatalf("Expected one client credentials request, got %d", len(mockProvider.ClientCredentialsRequests))
+	}
+	if scope := mockProvider.ClientCredentialsRequests[0].Get("scope"); scope != "openid api" {
+		t.Errorf("Expected the configured scopes, got %q", scope)
+	}
+}
+
+func TestAuthenticator_DeviceFlowDenied(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	mockProvider.DeviceErrors = []string{"authorization_pending", "slow_down", "access_denied"}
+
+	cfg := &config.Config{
+		IssuerURL: mockProvider.IssuerURL,
+		ClientID:  "test-client-id",
+		Headless:  true,
+	}
+
+	clock := &fakeClock{now: time.Now()}
+	_, err := NewAuthenticator(cfg, WithClock(clock)).Authenticate()
+	if err == nil {
+		t.Fatal("Expected error when device authorization is denied")
+	}
+	if !strings.Contains(err.Error(), "denied") {
+		t.Errorf("Expected access denied error, got: %v", err)
+	}
+	if len(mockProvider.DeviceErrors) != 0 {
+		t.Errorf("Expected all device errors to be consumed, %d left", len(mockProvider.DeviceErrors))
+	}
+	// slow_down adds 5 seconds to the polling interval
+	want := []time.Duration{time.Second, time.Second, 6 * time.Second}
+	if !reflect.DeepEqual(clock.waits, want) {
+		t.Errorf("Expected polling waits %v, got %v", want, clock.waits)
+	}
+}
+
+func TestAuthenticator_DeviceFlowAuthParams(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	mockProvider.DeviceErrors = []string{"access_denied"}
+
+	cfg := &config.Config{
+		IssuerURL:  mockProvider.IssuerURL,
+		ClientID:   "test-client-id",
+		Headless:   true,
+		AuthParams: map[string]string{"audience": "kubernetes"},
+		LoginHint:  "sre@example.com",
+	}
+
+	NewAuthenticator(cfg).Authenticate()
+	if len(mockProvider.DeviceRequests) != 1 {
+		t.Fatalf("Expected one device authorization request, got %d", len(mockProvider.DeviceRequests))
+	}
+	form := mockProvider.DeviceRequests[0]
+	if form.Get("audience") != "kubernetes" || form.Get("login_hint") != "sre@example.com" {
+		t.Errorf("Expected auth params in the device authorization request, got %v", form)
+	}
+	if form.Get("scope") != "openid profile email offline_access" {
+		t.Errorf("Expected the default scopes, got %q", form.Get("scope"))
+	}
+}
+
+func TestAuthenticator_DeviceFlowExpired(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	mockProvider.DeviceErrors = []string{"expired_token"}
+	mockProvider.DeviceCompleteURI = true
+
+	cfg := &config.Config{
+		IssuerURL: mockProvider.IssuerURL,
+		ClientID:  "test-client-id",
+		Headless:  true,
+	}
+
+	_, err := NewAuthenticator(cfg, WithClock(&fakeClock{now: time.Now()})).Authenticate()
+	if err == nil {
+		t.Fatal("Expected error when device code expires")
+	}
+	if !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Expected expired error, got: %v", err)
+	}
+}
+
+func TestAuthenticator_Revoke(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	cfg := &config.Config{
+		IssuerURL: mockProvider.IssuerURL,
+		ClientID:  "test-client-id",
+	}
+
+	mockProvider.Tokens["test-code"] = &MockToken{
+		AccessToken:  "access-token",
+		RefreshToken: "refresh-token",
+	}
+
+	authenticator := NewAuthenticator(cfg)
+	err := authenticator.Revoke(&types.TokenInfo{
+		AccessToken:  "access-token",
+		RefreshToken: "refresh-token",
+	})
+	if err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+
+	if len(mockProvider.RevokedTokens) != 2 || mockProvider.RevokedTokens[0] != "refresh-token" || mockProvider.RevokedTokens[1] != "access-token" {
+		t.Errorf("Expected refresh and access tokens to be revoked, got %v", mockProvider.RevokedTokens)
+	}
+
+	// The revoked refresh token can no longer be used
+	if _, err := authenticator.RefreshToken(&types.TokenInfo{RefreshToken: "refresh-token"}); err == nil {
+		t.Error("Expected refresh with a revoked token to fail")
+	}
+
+	// The access token is revoked even if the refresh token can't be
+	mockProvider.RevokedTokens = nil
+	mockProvider.FailRevocation = map[string]bool{"other-refresh-token": true}
+	err = authenticator.Revoke(&types.TokenInfo{AccessToken: "other-access-token", RefreshToken: "other-refresh-token"})
+	if err == nil {
+		t.Error("Expected the failed refresh token revocation to be reported")
+	}
+	if len(mockProvider.RevokedTokens) != 1 || mockProvider.RevokedTokens[0] != "other-access-token" {
+		t.Errorf("Expected the access token to be revoked, got %v", mockProvider.RevokedTokens)
+	}
+}
+
+func TestAuthenticator_EndSessionURL(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	cfg := &config.Config{
+		IssuerURL: mockProvider.IssuerURL,
+		ClientID:  "test-client-id",
+	}
+
+	endSessionURL, err := NewAuthenticator(cfg).EndSessionURL("test-id-token")
+	if err != nil {
+		t.Fatalf("EndSessionURL failed: %v", err)
+	}
+
+	if !strings.HasPrefix(endSessionURL, mockProvider.IssuerURL+"/logout?") {
+		t.Errorf("Expected end session endpoint, got %s", endSessionURL)
+	}
+	if !strings.Contains(endSessionURL, "id_token_hint=test-id-token") || !strings.Contains(endSessionURL, "client_id=test-client-id") {
+		t.Errorf("Expected id_token_hint and client_id, got %s", endSessionURL)
 	}
 }
 
@@ -50,7 +361,7 @@ func TestAuthenticator_NewAuthenticator(t *testing.T) {
 		ClientID:     "test-client-id",
 		ClientSecret: "test-secret",
 		Headless:     false,
-		Port:         8000,
+		Port:         "8000",
 	}
 
 	authenticator := NewAuthenticator(cfg)
@@ -126,6 +437,176 @@ func TestMockOIDCProvider_GetOAuth2Config(t *testing.T) {
 	}
 }
 
+// mockVerifier returns a verifier of ID tokens issued by the mock provider for test-client-id
+func mockVerifier(t *testing.T, mockProvider *MockOIDCProvider) *oidc.IDTokenVerifier {
+	t.Helper()
+	provider, err := oidc.NewProvider(context.Background(), mockProvider.IssuerURL)
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	return provider.Verifier(&oidc.Config{ClientID: "test-client-id"})
+}
+
+// mockIDToken returns an ID token signed by the mock provider
+func mockIDToken(t *testing.T, mockProvider *MockOIDCProvider, nonce string) string {
+	t.Helper()
+	idToken, err := mockProvider.generateIDToken(nonce)
+	if err != nil {
+		t.Fatalf("generateIDToken failed: %v", err)
+	}
+	return idToken
+}
+
+func TestMockOIDCProvider_IDToken(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+	verifier := mockVerifier(t, mockProvider)
+
+	for _, algorithm := range []jose.SignatureAlgorithm{jose.RS256, jose.ES256} {
+		mockProvider.SigningAlgorithm = algorithm
+		idToken, err := verifier.Verify(context.Background(), mockIDToken(t, mockProvider, "nonce-1"))
+		if err != nil {
+			t.Fatalf("%s: Verify failed: %v", algorithm, err)
+		}
+		if idToken.Subject != "test-user-123" || idToken.Nonce != "nonce-1" {
+			t.Errorf("%s: Expected the mock user and the nonce, got %q and %q", algorithm, idToken.Subject, idToken.Nonce)
+		}
+	}
+
+	// An unsupported algorithm is an error, not a panic
+	mockProvider.SigningAlgorithm = jose.HS256
+	if _, err := mockProvider.generateIDToken(""); err == nil {
+		t.Error("Expected an error for an unsupported signing algorithm")
+	}
+}
+
+func TestMockOIDCProvider_IDTokenClaims(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	mockProvider.IDTokenClaims = map[string]interface{}{
+		"groups": []string{"admins", "developers"},
+		"name":   nil,
+	}
+	idToken, err := mockVerifier(t, mockProvider).Verify(context.Background(), mockIDToken(t, mockProvider, ""))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		t.Fatalf("Claims failed: %v", err)
+	}
+	if groups, ok := claims["groups"].([]interface{}); !ok || len(groups) != 2 {
+		t.Errorf("Expected the configured groups claim, got %v", claims["groups"])
+	}
+	if _, ok := claims["name"]; ok {
+		t.Error("Expected the name claim to be removed")
+	}
+	if _, ok := claims["nonce"]; ok {
+		t.Error("Expected no nonce claim without a nonce")
+	}
+}
+
+func TestMockOIDCProvider_BadIDToken(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+	verifier := mockVerifier(t, mockProvider)
+
+	tests := []struct {
+		bad  BadIDToken
+		want string
+	}{
+		{BadIDTokenAudience, "audience"},
+		{BadIDTokenExpired, "expired"},
+		{BadIDTokenSignature, "signature"},
+	}
+	for _, tt := range tests {
+		mockProvider.BadIDToken = tt.bad
+		_, err := verifier.Verify(context.Background(), mockIDToken(t, mockProvider, ""))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Expected a verification error about the %s, got %v", tt.bad, tt.want, err)
+		}
+	}
+}
+
+func TestMockOIDCProvider_RotateKeys(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+	verifier := mockVerifier(t, mockProvider)
+
+	previous := mockIDToken(t, mockProvider, "")
+	if _, err := verifier.Verify(context.Background(), previous); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	// Tokens signed with the previous key verify while it is still published
+	if err := mockProvider.RotateKeys(true); err != nil {
+		t.Fatalf("RotateKeys failed: %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), mockIDToken(t, mockProvider, "")); err != nil {
+		t.Errorf("Expected a token signed with the new key to verify, got %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), previous); err != nil {
+		t.Errorf("Expected a token signed with the previous key to verify, got %v", err)
+	}
+
+	// go-oidc keeps the keys it fetched, so a retired key fails with a fresh verifier
+	if err := mockProvider.RotateKeys(false); err != nil {
+		t.Fatalf("RotateKeys failed: %v", err)
+	}
+	if _, err := mockVerifier(t, mockProvider).Verify(context.Background(), previous); err == nil {
+		t.Error("Expected a token signed with a retired key to fail verification")
+	}
+}
+
+func TestAuthenticator_ExchangeCodeNonce(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	authenticator := NewAuthenticator(&config.Config{IssuerURL: mockProvider.IssuerURL, ClientID: "test-client-id"})
+	provider, err := oidc.NewProvider(context.Background(), mockProvider.IssuerURL)
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	oauth2Config := authenticator.oauth2Config(provider, "http://localhost:8000/callback")
+	verifier := provider.Verifier(&oidc.Config{ClientID: "test-client-id"})
+
+	// authorize plays the browser and returns the code of the callback
+	authorize := func(req *authRequest) string {
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(authenticator.authCodeURL(oauth2Config, req))
+		if err != nil {
+			t.Fatalf("Authorization request failed: %v", err)
+		}
+		resp.Body.Close()
+		location, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatalf("Invalid callback URL: %v", err)
+		}
+		return location.Query().Get("code")
+	}
+
+	req, err := newAuthRequest()
+	if err != nil {
+		t.Fatalf("newAuthRequest failed: %v", err)
+	}
+	if _, err := authenticator.exchangeCode(oauth2Config, verifier, req, authorize(req)); err != nil {
+		t.Fatalf("Expected the echoed nonce to match, got %v", err)
+	}
+
+	// An ID token issued for another authorization request is rejected
+	other, err := newAuthRequest()
+	if err != nil {
+		t.Fatalf("newAuthRequest failed: %v", err)
+	}
+	code := authorize(other)
+	other.nonce = req.nonce
+	if _, err := authenticator.exchangeCode(oauth2Config, verifier, other, code); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("Expected a nonce mismatch, got %v", err)
+	}
+}
+
 // Integration test helper - can be used for manual testing
 func TestAuthenticator_Integration(t *testing.T) {
 	if testing.Short() {
@@ -148,7 +629,7 @@ func TestAuthenticator_Integration(t *testing.T) {
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		Headless:     false,
-		Port:         8001, // Use different port to avoid conflicts
+		Port:         "8001", // Use different port to avoid conflicts
 	}
 
 	authenticator := NewAuthenticator(cfg)
@@ -173,3 +654,244 @@ func TestAuthenticator_Integration(t *testing.T) {
 	t.Logf("Successfully authenticated! Token expires at: %v", token.Expiry)
 }
 
+func TestAuthenticator_RefreshTokenInvalidGrant(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	authenticator := NewAuthenticator(&config.Config{
+		IssuerURL: mockProvider.IssuerURL,
+		ClientID:  "test-client-id",
+	})
+
+	_, err := authenticator.RefreshToken(&types.TokenInfo{RefreshToken: "revoked-refresh-token"})
+	if !IsInvalidGrant(err) {
+		t.Errorf("Expected an invalid_grant error, got %v", err)
+	}
+	if IsInvalidGrant(os.ErrNotExist) {
+		t.Error("IsInvalidGrant should be false for other errors")
+	}
+}
+
+func TestListenLoopback(t *testing.T) {
+	listener, port, err := listenLoopback(&config.Config{Port: "auto"})
+	if err != nil {
+		t.Fatalf("listenLoopback failed: %v", err)
+	}
+	defer listener.Close()
+	if ip := listener.Addr().(*net.TCPAddr).IP; !ip.IsLoopback() {
+		t.Errorf("Expected a loopback listener, got %v", ip)
+	}
+
+	// A taken port falls through to the next candidate
+	fallback, fallbackPort, err := listenLoopback(&config.Config{Port: fmt.Sprintf("%d,auto", port)})
+	if err != nil {
+		t.Fatalf("listenLoopback failed: %v", err)
+	}
+	defer fallback.Close()
+	if fallbackPort == port || fallbackPort == 0 {
+		t.Errorf("Expected a free port other than %d, got %d", port, fallbackPort)
+	}
+
+	// Without a free candidate, listening fails
+	if _, _, err := listenLoopback(&config.Config{Port: strconv.Itoa(port)}); err == nil {
+		t.Error("Expected an error when the only port is taken")
+	}
+}
+
+func TestPastedCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr string
+	}{
+		{"redirect URL", "http://localhost:8000/callback?code=abc&state=xyz", "abc", ""},
+		{"query only", "code=abc&state=xyz", "abc", ""},
+		{"bare code", "abc", "abc", ""},
+		{"wrong state", "http://localhost:8000/callback?code=abc&state=other", "", "invalid state"},
+		{"provider error", "http://localhost:8000/callback?error=access_denied&state=xyz", "", "access_denied"},
+		{"empty", "", "", "no authorization code"},
+	}
+	for _, tt := range tests {
+		code, err := pastedCode(tt.input, "xyz")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || code != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, code, err, tt.want)
+		}
+	}
+}
+
+func TestManualLogin(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(name string) string { return vars[name] }
+	}
+	ssh := "10.0.0.1 50000 10.0.0.2 22"
+
+	if !manualLogin(&config.Config{}, env(map[string]string{"SSH_CONNECTION": ssh})) {
+		t.Error("Expected a manual login over SSH without a display")
+	}
+	if manualLogin(&config.Config{}, env(map[string]string{"SSH_CONNECTION": ssh, "DISPLAY": "localhost:10.0"})) {
+		t.Error("Expected a browser login over SSH with X forwarding")
+	}
+	if manualLogin(&config.Config{}, env(nil)) {
+		t.Error("Expected a browser login outside SSH")
+	}
+	if !manualLogin(&config.Config{Manual: true}, env(nil)) {
+		t.Error("Expected a manual login when configured")
+	}
+
+	if got := manualRedirectURL(&config.Config{Port: "auto,9000"}); got != "http://127.0.0.1:9000/callback" {
+		t.Errorf("Expected the first configured port in the redirect URI, got %s", got)
+	}
+}
+
+func TestAuthenticator_ManualLogin(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	authenticator := NewAuthenticator(&config.Config{IssuerURL: mockProvider.IssuerURL, ClientID: "test-client-id"})
+	provider, err := oidc.NewProvider(context.Background(), mockProvider.IssuerURL)
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	oauth2Config := authenticator.oauth2Config(provider, "http://localhost:8000/callback")
+	req, err := newAuthRequest()
+	if err != nil {
+		t.Fatalf("newAuthRequest failed: %v", err)
+	}
+
+	// Play the user: open the printed URL and paste back where the browser was redirected
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	go func() {
+		defer inWriter.Close()
+		out := bufio.NewReader(outReader)
+		line, err := out.ReadString('\n')
+		for err == nil && !strings.HasPrefix(strings.TrimSpace(line), "http") {
+			line, err = out.ReadString('\n')
+		}
+		go io.Copy(io.Discard, out)
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(strings.TrimSpace(line))
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+		fmt.Fprintln(inWriter, resp.Header.Get("Location"))
+	}()
+
+	token, err := authenticator.authenticateManual(oauth2Config, provider.Verifier(&oidc.Config{ClientID: "test-client-id"}), req, inReader, outWriter)
+	if err != nil {
+		t.Fatalf("Manual login failed: %v", err)
+	}
+	if token.IDToken == "" || token.RefreshToken == "" {
+		t.Errorf("Expected ID and refresh tokens, got %+v", token)
+	}
+}
+
+func TestOpenBrowser_Command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as browser")
+	}
+	out := filepath.Join(t.TempDir(), "url")
+
+	// The URL is appended as last argument, $0 of the script
+	command := []string{"sh", "-c", `printf %s "$0" > ` + out + `.tmp && mv ` + out + `.tmp ` + out}
+	if err := OpenBrowser(command, "https://issuer.example.com/authorize?state=x"); err != nil {
+		t.Fatalf("OpenBrowser failed: %v", err)
+	}
+
+	var data []byte
+	for i := 0; i < 100 && len(data) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+		data, _ = os.ReadFile(out)
+	}
+	if string(data) != "https://issuer.example.com/authorize?state=x" {
+		t.Errorf("Expected the browser command to get the URL, got %q", data)
+	}
+
+	if err := OpenBrowser([]string{filepath.Join(t.TempDir(), "no-such-browser")}, "https://issuer.example.com"); err == nil {
+		t.Error("Expected an error for a missing browser command")
+	}
+}
+
+// fakeClock returns from waits immediately, advancing its time instead
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.waits = append(c.waits, d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestAuthenticator_BrowserTimeout(t *testing.T) {
+	// Over SSH the manual login would wait for input instead
+	t.Setenv("SSH_CONNECTION", "")
+
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	// The browser never calls back, and the clock makes the login time out at once
+	var opened string
+	authenticator := NewAuthenticator(&config.Config{IssuerURL: mockProvider.IssuerURL, ClientID: "test-client-id", Port: "auto"},
+		WithBrowserOpener(BrowserOpenerFunc(func(url string) error {
+			opened = url
+			return nil
+		})),
+		WithClock(&fakeClock{now: time.Now()}))
+
+	_, err := authenticator.Authenticate()
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	if !strings.HasPrefix(opened, mockProvider.IssuerURL+"/authorize?") {
+		t.Errorf("Expected the browser to be opened on the authorization endpoint, got %q", opened)
+	}
+}
+
+// countingTransport counts the requests it passes on
+type countingTransport struct {
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestAuthenticator_HTTPClient(t *testing.T) {
+	mockProvider := NewMockOIDCProvider()
+	defer mockProvider.Close()
+
+	transport := &countingTransport{}
+	authenticator := NewAuthenticator(&config.Config{IssuerURL: mockProvider.IssuerURL, ClientID: "test-client-id"},
+		WithHTTPClient(&http.Client{Transport: transport}))
+
+	// Discovery and both revocation requests go through the client
+	if err := authenticator.Revoke(&types.TokenInfo{AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if transport.requests != 3 {
+		t.Errorf("Expected 3 requests through the client, got %d", transport.requests)
+	}
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+// DecodeClaims decodes the payload of a JWT into v without verifying its signature.
+// It must only be used on tokens that were verified when they were obtained.
+func DecodeClaims(rawJWT string, v interface{}) error {
+	parts := strings.Split(rawJWT, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed JWT: expected 3 parts, got %d", len(parts))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return fmt.Errorf("malformed JWT payload: %w", err)
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("malformed JWT claims: %w", err)
+	}
+
+	return nil
+}
+
+// Identity holds the identity claims of an ID token
+type Identity struct {
+	Subject  string     `json:"sub"`
+	Email    string     `json:"email,omitempty"`
+	Groups   []string   `json:"groups,omitempty"`
+	Audience []string   `json:"aud"`
+	Issuer   string     `json:"iss"`
+	Expiry   time.Time  `json:"exp"`
+	AuthTime *time.Time `json:"auth_time,omitempty"`
+}
+
+// stringList decodes a claim that may be a single string or an array of strings
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// ParseIdentity decodes the identity claims of an ID token without verifying it
+func ParseIdentity(rawIDToken string) (*Identity, error) {
+	var claims struct {
+		Subject  string     `json:"sub"`
+		Email    string     `json:"email"`
+		Groups   stringList `json:"groups"`
+		Audience stringList `json:"aud"`
+		Issuer   string     `json:"iss"`
+		Expiry   int64      `json:"exp"`
+		AuthTime int64      `json:"auth_time"`
+	}
+	if err := DecodeClaims(rawIDToken, &claims); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		Groups:   claims.Groups,
+		Audience: claims.Audience,
+		Issuer:   claims.Issuer,
+		Expiry:   time.Unix(claims.Expiry, 0),
+	}
+	if claims.AuthTime != 0 {
+		authTime := time.Unix(claims.AuthTime, 0)
+		identity.AuthTime = &authTime
+	}
+
+	return identity, nil
+}
+
+// CredentialToken returns the token of the given type (config.TokenTypeIDToken or
+// config.TokenTypeAccessToken) and its expiry. The expiry is taken from the token's
+// exp claim; opaque access tokens fall back to the expiry reported by the token endpoint.
+func CredentialToken(token *types.TokenInfo, tokenType string) (string, time.Time, error) {
+	switch tokenType {
+	case "", config.TokenTypeIDToken:
+		if token.IDToken == "" {
+			return "", time.Time{}, fmt.Errorf("no ID token available")
+		}
+		expiry, err := jwtExpiry(token.IDToken)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to read ID token expiry: %w", err)
+		}
+		return token.IDToken, expiry, nil
+
+	case config.TokenTypeAccessToken:
+		if token.AccessToken == "" {
+			return "", time.Time{}, fmt.Errorf("no access token available")
+		}
+		if expiry, err := jwtExpiry(token.AccessToken); err == nil {
+			return token.AccessToken, expiry, nil
+		}
+		return token.AccessToken, token.Expiry, nil
+
+	default:
+		return "", time.Time{}, fmt.Errorf("unsupported token type %q (expected %q or %q)",
+			tokenType, config.TokenTypeIDToken, config.TokenTypeAccessToken)
+	}
+}
+
+// jwtExpiry returns the exp claim of a JWT
+func jwtExpiry(rawJWT string) (time.Time, error) {
+	var claims struct {
+		Expiry int64 `json:"exp"`
+	}
+	if err := DecodeClaims(rawJWT, &claims); err != nil {
+		return time.Time{}, err
+	}
+	if claims.Expiry == 0 {
+		return time.Time{}, fmt.Errorf("token has no exp claim")
+	}
+	return time.Unix(claims.Expiry, 0), nil
+}
+
+// RefreshTokenExpiry returns the expiry of a refresh token. Most providers
+// issue opaque refresh tokens, for which ok is false.
+func RefreshTokenExpiry(refreshToken string) (expiry time.Time, ok bool) {
+	expiry, err := jwtExpiry(refreshToken)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expiry, true
+}
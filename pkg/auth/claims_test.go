@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+// unsignedJWT builds a JWT with the given claims and a dummy signature
+func unsignedJWT(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Failed to marshal claims: %v", err)
+	}
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+}
+
+func TestDecodeClaims(t *testing.T) {
+	raw := unsignedJWT(t, map[string]interface{}{"sub": "user-1", "email": "user@example.com"})
+
+	var claims struct {
+		Subject string `json:"sub"`
+		Email   string `json:"email"`
+	}
+	if err := DecodeClaims(raw, &claims); err != nil {
+		t.Fatalf("DecodeClaims failed: %v", err)
+	}
+
+	if claims.Subject != "user-1" {
+		t.Errorf("Expected sub 'user-1', got '%s'", claims.Subject)
+	}
+	if claims.Email != "user@example.com" {
+		t.Errorf("Expected email 'user@example.com', got '%s'", claims.Email)
+	}
+}
+
+func TestDecodeClaims_Malformed(t *testing.T) {
+	for _, raw := range []string{"", "opaque-token", "a.!!!.c", "a." + base64.RawURLEncoding.EncodeToString([]byte("not json")) + ".c"} {
+		var claims map[string]interface{}
+		if err := DecodeClaims(raw, &claims); err == nil {
+			t.Errorf("Expected error for %q", raw)
+		}
+	}
+}
+
+func TestParseIdentity(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	raw := unsignedJWT(t, map[string]interface{}{
+		"sub":       "user-1",
+		"email":     "user@example.com",
+		"groups":    []string{"admins", "developers"},
+		"aud":       "test-client-id",
+		"iss":       "https://test-issuer.com",
+		"exp":       expiry.Unix(),
+		"auth_time": authTime.Unix(),
+	})
+
+	identity, err := ParseIdentity(raw)
+	if err != nil {
+		t.Fatalf("ParseIdentity failed: %v", err)
+	}
+
+	if identity.Subject != "user-1" || identity.Email != "user@example.com" || identity.Issuer != "https://test-issuer.com" {
+		t.Errorf("Unexpected identity: %+v", identity)
+	}
+	if len(identity.Groups) != 2 || identity.Groups[0] != "admins" {
+		t.Errorf("Expected groups [admins developers], got %v", identity.Groups)
+	}
+	if len(identity.Audience) != 1 || identity.Audience[0] != "test-client-id" {
+		t.Errorf("Expected single audience to be decoded as a list, got %v", identity.Audience)
+	}
+	if !identity.Expiry.Equal(expiry) {
+		t.Errorf("Expected expiry %v, got %v", expiry, identity.Expiry)
+	}
+	if identity.AuthTime == nil || !identity.AuthTime.Equal(authTime) {
+		t.Errorf("Expected auth_time %v, got %v", authTime, identity.AuthTime)
+	}
+}
+
+func TestParseIdentity_AudienceList(t *testing.T) {
+	raw := unsignedJWT(t, map[string]interface{}{
+		"sub": "user-1",
+		"aud": []string{"client-a", "client-b"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	identity, err := ParseIdentity(raw)
+	if err != nil {
+		t.Fatalf("ParseIdentity failed: %v", err)
+	}
+
+	if len(identity.Audience) != 2 || identity.Audience[1] != "client-b" {
+		t.Errorf("Expected audience [client-a client-b], got %v", identity.Audience)
+	}
+	if identity.AuthTime != nil {
+		t.Errorf("Expected no auth_time, got %v", identity.AuthTime)
+	}
+}
+
+func TestCredentialToken(t *testing.T) {
+	idExpiry := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	accessExpiry := time.Now().Add(1 * time.Hour).Truncate(time.Second)
+
+	token := &types.TokenInfo{
+		AccessToken: "opaque-access-token",
+		IDToken:     unsignedJWT(t, map[string]interface{}{"exp": idExpiry.Unix()}),
+		Expiry:      accessExpiry,
+	}
+
+	// ID token is the default and uses its own exp claim
+	for _, tokenType := range []string{"", config.TokenTypeIDToken} {
+		value, expiry, err := CredentialToken(token, tokenType)
+		if err != nil {
+			t.Fatalf("CredentialToken(%q) failed: %v", tokenType, err)
+		}
+		if value != token.IDToken {
+			t.Errorf("Expected ID token for %q", tokenType)
+		}
+		if !expiry.Equal(idExpiry) {
+			t.Errorf("Expected expiry %v, got %v", idExpiry, expiry)
+		}
+	}
+
+	// Opaque access token falls back to the token endpoint expiry
+	value, expiry, err := CredentialToken(token, config.TokenTypeAccessToken)
+	if err != nil {
+		t.Fatalf("CredentialToken(access_token) failed: %v", err)
+	}
+	if value != token.AccessToken {
+		t.Error("Expected access token")
+	}
+	if !expiry.Equal(accessExpiry) {
+		t.Errorf("Expected expiry %v, got %v", accessExpiry, expiry)
+	}
+
+	// JWT access token uses its exp claim
+	jwtExpiryTime := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	token.AccessToken = unsignedJWT(t, map[string]interface{}{"exp": jwtExpiryTime.Unix()})
+	if _, expiry, err = CredentialToken(token, config.TokenTypeAccessToken); err != nil {
+		t.Fatalf("CredentialToken(access_token) failed: %v", err)
+	}
+	if !expiry.Equal(jwtExpiryTime) {
+		t.Errorf("Expected expiry %v, got %v", jwtExpiryTime, expiry)
+	}
+}
+
+func TestCredentialToken_Errors(t *testing.T) {
+	token := &types.TokenInfo{AccessToken: "opaque", Expiry: time.Now().Add(time.Hour)}
+
+	if _, _, err := CredentialToken(token, config.TokenTypeIDToken); err == nil {
+		t.Error("Expected error when ID token is missing")
+	}
+	if _, _, err := CredentialToken(token, "refresh_token"); err == nil {
+		t.Error("Expected error for unsupported token type")
+	}
+
+	token.IDToken = "opaque-id-token"
+	if _, _, err := CredentialToken(token, config.TokenTypeIDToken); err == nil {
+		t.Error("Expected error when ID token has no readable exp claim")
+	}
+}
+
+func TestRefreshTokenExpiry(t *testing.T) {
+	exp := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	expiry, ok := RefreshTokenExpiry(unsignedJWT(t, map[string]interface{}{"exp": exp.Unix()}))
+	if !ok || !expiry.Equal(exp) {
+		t.Errorf("Expected expiry %v, got %v (ok=%v)", exp, expiry, ok)
+	}
+
+	if _, ok := RefreshTokenExpiry("opaque-refresh-token"); ok {
+		t.Error("Expected no expiry for an opaque refresh token")
+	}
+}
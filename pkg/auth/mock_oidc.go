@@ -1,13 +1,21 @@
 package auth
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"sync"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
 	"golang.org/x/oauth2"
 )
 
@@ -21,6 +29,63 @@ type MockOIDCProvider struct {
 	TokenURL         string
 	UserInfo         map[string]interface{}
 	Tokens           map[string]*MockToken
+
+	// DeviceInterval is the polling interval (seconds) returned by the device endpoint
+	DeviceInterval int
+	// DeviceErrors is the sequence of RFC 8628 error codes returned while polling
+	// the token endpoint before the device code is granted
+	DeviceErrors []string
+	// DeviceCompleteURI enables verification_uri_complete in device responses
+	DeviceCompleteURI bool
+
+	// OmitRefreshIDToken leaves id_token out of refresh_token grant responses
+	OmitRefreshIDToken bool
+	// OmitRefreshToken leaves refresh_token out of refresh_token grant responses
+	OmitRefreshToken bool
+	// ClientCredentialsIDToken adds an id_token to client_credentials grant
+	// responses, which most providers leave out
+	ClientCredentialsIDToken bool
+
+	// RevokedTokens records the tokens revoked at the revocation endpoint
+	RevokedTokens []string
+	// FailRevocation makes the revocation endpoint fail for these tokens
+	FailRevocation map[string]bool
+	// DeviceRequests records the forms posted to the device authorization endpoint
+	DeviceRequests []url.Values
+	// ClientCredentialsRequests records the client_credentials grant requests
+	ClientCredentialsRequests []url.Values
+
+	// SigningAlgorithm signs new ID tokens: RS256 (the default) or ES256
+	SigningAlgorithm jose.SignatureAlgorithm
+	// IDTokenClaims are set in new ID tokens, overriding the default claims;
+	// a nil value removes the claim
+	IDTokenClaims map[string]interface{}
+	// BadIDToken makes new ID tokens fail verification, for negative tests
+	BadIDToken BadIDToken
+
+	// keys are the signing keys published at the jwks_uri, the current ones last
+	keys   []*mockKey
+	keysMu sync.Mutex
+	keySeq int
+}
+
+// BadIDToken is a way in which the mock issues invalid ID tokens
+type BadIDToken string
+
+const (
+	// BadIDTokenAudience issues ID tokens for another client
+	BadIDTokenAudience BadIDToken = "audience"
+	// BadIDTokenExpired issues ID tokens that expired an hour ago
+	BadIDTokenExpired BadIDToken = "expired"
+	// BadIDTokenSignature signs ID tokens with a key that is not published
+	BadIDTokenSignature BadIDToken = "signature"
+)
+
+// mockKey is a signing key of the mock provider
+type mockKey struct {
+	id        string
+	algorithm jose.SignatureAlgorithm
+	private   crypto.Signer
 }
 
 // MockToken represents a mock token response
@@ -40,7 +105,8 @@ func NewMockOIDCProvider() *MockOIDCProvider {
 			"email": "test@example.com",
 			"name":  "Test User",
 		},
-		Tokens: make(map[string]*MockToken),
+		Tokens:         make(map[string]*MockToken),
+		DeviceInterval: 1,
 	}
 
 	mux := http.NewServeMux()
@@ -48,14 +114,17 @@ func NewMockOIDCProvider() *MockOIDCProvider {
 	// Well-known configuration endpoint
 	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
 		config := map[string]interface{}{
-			"issuer":                 mock.server.URL,
-			"authorization_endpoint": mock.server.URL + "/authorize",
-			"token_endpoint":         mock.server.URL + "/token",
-			"userinfo_endpoint":       mock.server.URL + "/userinfo",
-			"jwks_uri":               mock.server.URL + "/.well-known/jwks.json",
-			"response_types_supported": []string{"code"},
-			"subject_types_supported": []string{"public"},
-			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"issuer":                                mock.server.URL,
+			"authorization_endpoint":                mock.server.URL + "/authorize",
+			"token_endpoint":                        mock.server.URL + "/token",
+			"userinfo_endpoint":                     mock.server.URL + "/userinfo",
+			"jwks_uri":                              mock.server.URL + "/.well-known/jwks.json",
+			"device_authorization_endpoint":         mock.server.URL + "/device/code",
+			"revocation_endpoint":                   mock.server.URL + "/revoke",
+			"end_session_endpoint":                  mock.server.URL + "/logout",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256", "ES256"},
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(config)
@@ -66,12 +135,17 @@ func NewMockOIDCProvider() *MockOIDCProvider {
 		state := r.URL.Query().Get("state")
 		redirectURI := r.URL.Query().Get("redirect_uri")
 		code := fmt.Sprintf("mock-auth-code-%d", time.Now().UnixNano())
+		idToken, err := mock.generateIDToken(r.URL.Query().Get("nonce"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-		// Store code for token exchange
+		// Store code for token exchange, echoing the nonce in the ID token
 		mock.Tokens[code] = &MockToken{
 			AccessToken:  "mock-access-token-" + code,
 			RefreshToken: "mock-refresh-token-" + code,
-			IDToken:      mock.generateIDToken(),
+			IDToken:      idToken,
 			ExpiresIn:    3600,
 			TokenType:    "Bearer",
 		}
@@ -81,6 +155,45 @@ func NewMockOIDCProvider() *MockOIDCProvider {
 		http.Redirect(w, r, redirectURL, http.StatusFound)
 	})
 
+	// Device authorization endpoint (RFC 8628)
+	mux.HandleFunc("/device/code", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.ParseForm()
+		mock.DeviceRequests = append(mock.DeviceRequests, r.PostForm)
+
+		deviceCode := fmt.Sprintf("mock-device-code-%d", time.Now().UnixNano())
+		idToken, err := mock.generateIDToken("")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		mock.Tokens[deviceCode] = &MockToken{
+			AccessToken:  "mock-access-token-" + deviceCode,
+			RefreshToken: "mock-refresh-token-" + deviceCode,
+			IDToken:      idToken,
+			ExpiresIn:    3600,
+			TokenType:    "Bearer",
+		}
+
+		response := map[string]interface{}{
+			"device_code":      deviceCode,
+			"user_code":        "MOCK-CODE",
+			"verification_uri": mock.server.URL + "/device",
+			"expires_in":       600,
+			"interval":         mock.DeviceInterval,
+		}
+		if mock.DeviceCompleteURI {
+			response["verification_uri_complete"] = mock.server.URL + "/device?user_code=MOCK-CODE"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+
 	// Token endpoint
 	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
@@ -106,10 +219,15 @@ func NewMockOIDCProvider() *MockOIDCProvider {
 			for _, t := range mock.Tokens {
 				if t.RefreshToken == refreshToken {
 					// Generate new tokens
+					idToken, err := mock.generateIDToken("")
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+						return
+					}
 					token = &MockToken{
 						AccessToken:  "refreshed-access-token",
 						RefreshToken: refreshToken,
-						IDToken:      mock.generateIDToken(),
+						IDToken:      idToken,
 						ExpiresIn:    3600,
 						TokenType:    "Bearer",
 					}
@@ -117,9 +235,44 @@ func NewMockOIDCProvider() *MockOIDCProvider {
 				}
 			}
 			if token == nil {
-				http.Error(w, "Invalid refresh token", http.StatusBadRequest)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+		} else if grantType == "urn:ietf:params:oauth:grant-type:device_code" {
+			if len(mock.DeviceErrors) > 0 {
+				errorCode := mock.DeviceErrors[0]
+				mock.DeviceErrors = mock.DeviceErrors[1:]
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": errorCode})
+				return
+			}
+			token, ok = mock.Tokens[r.FormValue("device_code")]
+			if !ok {
+				http.Error(w, "Invalid device code", http.StatusBadRequest)
+				return
+			}
+		} else if grantType == "client_credentials" {
+			mock.ClientCredentialsRequests = append(mock.ClientCredentialsRequests, r.PostForm)
+			if r.FormValue("client_secret") == "" {
+				http.Error(w, "Missing client secret", http.StatusUnauthorized)
 				return
 			}
+			token = &MockToken{
+				AccessToken: "client-credentials-access-token",
+				ExpiresIn:   3600,
+				TokenType:   "Bearer",
+			}
+			if mock.ClientCredentialsIDToken {
+				idToken, err := mock.generateIDToken("")
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				token.IDToken = idToken
+			}
 		} else {
 			http.Error(w, "Unsupported grant type", http.StatusBadRequest)
 			return
@@ -132,24 +285,73 @@ func NewMockOIDCProvider() *MockOIDCProvider {
 			"token_type":    token.TokenType,
 			"expires_in":    token.ExpiresIn,
 		}
+		if grantType == "client_credentials" {
+			delete(response, "refresh_token")
+			if token.IDToken == "" {
+				delete(response, "id_token")
+			}
+		}
+		if grantType == "refresh_token" {
+			if mock.OmitRefreshIDToken {
+				delete(response, "id_token")
+			}
+			if mock.OmitRefreshToken {
+				delete(response, "refresh_token")
+			}
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 	})
 
+	// Token revocation endpoint (RFC 7009)
+	mux.HandleFunc("/revoke", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.FormValue("token")
+		if token == "" {
+			http.Error(w, "Missing token", http.StatusBadRequest)
+			return
+		}
+		if mock.FailRevocation[token] {
+			http.Error(w, "Revocation failed", http.StatusServiceUnavailable)
+			return
+		}
+		mock.RevokedTokens = append(mock.RevokedTokens, token)
+
+		// Revoked refresh tokens can no longer be used
+		for code, t := range mock.Tokens {
+			if t.RefreshToken == token {
+				delete(mock.Tokens, code)
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// End session endpoint
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Logged out"))
+	})
+
 	// UserInfo endpoint
 	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(mock.UserInfo)
 	})
 
-	// JWKS endpoint (simplified)
+	// JWKS endpoint with the public signing keys
 	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
-		jwks := map[string]interface{}{
-			"keys": []interface{}{},
+		keys, err := mock.jwks()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(jwks)
+		json.NewEncoder(w).Encode(keys)
 	})
 
 	mock.server = httptest.NewServer(mux)
@@ -167,22 +369,157 @@ func (m *MockOIDCProvider) Close() {
 	}
 }
 
-// generateIDToken generates a simple mock ID token
-func (m *MockOIDCProvider) generateIDToken() string {
-	// In a real implementation, this would be a properly signed JWT
-	// For testing, we'll return a simple string that can be verified
+// generateIDToken signs an ID token for the mock user with the current key.
+// The nonce of the authorization request is echoed if set.
+func (m *MockOIDCProvider) generateIDToken(nonce string) (string, error) {
+	clientID := m.ClientID
+	if clientID == "" {
+		clientID = "test-client-id"
+	}
+	now := time.Now()
 	claims := map[string]interface{}{
 		"iss":   m.IssuerURL,
 		"sub":   m.UserInfo["sub"],
-		"aud":   "test-client-id",
-		"exp":   time.Now().Add(1 * time.Hour).Unix(),
-		"iat":   time.Now().Unix(),
+		"aud":   clientID,
+		"exp":   now.Add(1 * time.Hour).Unix(),
+		"iat":   now.Unix(),
 		"email": m.UserInfo["email"],
 		"name":  m.UserInfo["name"],
 	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	for name, value := range m.IDTokenClaims {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
 
-	data, _ := json.Marshal(claims)
-	return fmt.Sprintf("mock.id.token.%s", string(data))
+	key, err := m.signingKey()
+	if err != nil {
+		return "", err
+	}
+	signingKey := key.private
+	switch m.BadIDToken {
+	case BadIDTokenAudience:
+		claims["aud"] = "another-client-id"
+	case BadIDTokenExpired:
+		claims["iat"] = now.Add(-2 * time.Hour).Unix()
+		claims["exp"] = now.Add(-1 * time.Hour).Unix()
+	case BadIDTokenSignature:
+		// Same key ID and algorithm, but not the published key
+		if signingKey, err = generateKey(key.algorithm); err != nil {
+			return "", err
+		}
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: key.algorithm, Key: jose.JSONWebKey{Key: signingKey, KeyID: key.id}},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		return "", fmt.Errorf("mock OIDC provider: %w", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("mock OIDC provider: %w", err)
+	}
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		return "", fmt.Errorf("mock OIDC provider: %w", err)
+	}
+	return signed.CompactSerialize()
+}
+
+// RotateKeys replaces the signing keys with new ones. With keepPrevious, the
+// previous keys stay published so that tokens signed with them still verify.
+func (m *MockOIDCProvider) RotateKeys(keepPrevious bool) error {
+	m.keysMu.Lock()
+	defer m.keysMu.Unlock()
+
+	if !keepPrevious {
+		m.keys = nil
+	}
+	return m.addKeys()
+}
+
+// signingKey returns the current key for SigningAlgorithm
+func (m *MockOIDCProvider) signingKey() (*mockKey, error) {
+	algorithm := m.SigningAlgorithm
+	if algorithm == "" {
+		algorithm = jose.RS256
+	}
+
+	m.keysMu.Lock()
+	defer m.keysMu.Unlock()
+
+	if len(m.keys) == 0 {
+		if err := m.addKeys(); err != nil {
+			return nil, err
+		}
+	}
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		if m.keys[i].algorithm == algorithm {
+			return m.keys[i], nil
+		}
+	}
+	return nil, fmt.Errorf("mock OIDC provider: unsupported signing algorithm %s", algorithm)
+}
+
+// jwks returns the published keys. Keys are generated when first needed,
+// since RSA key generation is slow.
+func (m *MockOIDCProvider) jwks() (jose.JSONWebKeySet, error) {
+	m.keysMu.Lock()
+	defer m.keysMu.Unlock()
+
+	if len(m.keys) == 0 {
+		if err := m.addKeys(); err != nil {
+			return jose.JSONWebKeySet{}, err
+		}
+	}
+	var set jose.JSONWebKeySet
+	for _, key := range m.keys {
+		set.Keys = append(set.Keys, jose.JSONWebKey{
+			Key:       key.private.Public(),
+			KeyID:     key.id,
+			Algorithm: string(key.algorithm),
+			Use:       "sig",
+		})
+	}
+	return set, nil
+}
+
+// addKeys generates an RSA and an ECDSA signing key. Callers must hold keysMu.
+func (m *MockOIDCProvider) addKeys() error {
+	for _, algorithm := range []jose.SignatureAlgorithm{jose.RS256, jose.ES256} {
+		private, err := generateKey(algorithm)
+		if err != nil {
+			return err
+		}
+		m.keySeq++
+		m.keys = append(m.keys, &mockKey{
+			id:        fmt.Sprintf("mock-key-%d", m.keySeq),
+			algorithm: algorithm,
+			private:   private,
+		})
+	}
+	return nil
+}
+
+// generateKey generates a private key for algorithm, RS256 or ES256
+func generateKey(algorithm jose.SignatureAlgorithm) (crypto.Signer, error) {
+	var key crypto.Signer
+	var err error
+	if algorithm == jose.ES256 {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	} else {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mock OIDC provider: %w", err)
+	}
+	return key, nil
 }
 
 // GetOAuth2Config returns an OAuth2 config for the mock provider
@@ -198,4 +535,3 @@ func (m *MockOIDCProvider) GetOAuth2Config(clientID, clientSecret, redirectURL s
 		Scopes:      []string{oidc.ScopeOpenID, "profile", "email", "offline_access"},
 	}
 }
-
@@ -1,138 +1,349 @@
 package cache
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
+	"os/user"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
 	"github.com/chinnareddy578/kubectl-login/pkg/types"
 )
 
+// DefaultLoginLockTimeout is how long LockLogin waits for a login in another
+// process by default: longer than that login may take, so that waiting
+// processes don't start a second login while the first can still succeed. The
+// lock is released if the other process dies, so the wait ends early then.
+const DefaultLoginLockTimeout = config.LoginTimeout + time.Minute
+
+// ErrLoginLockTimeout is returned by LockLogin when another process holds the
+// login lock for longer than the timeout, e.g. for an abandoned browser login
+var ErrLoginLockTimeout = errors.New("timed out waiting for a login in another process")
+
+// loginLockPollInterval is how often LockLogin retries a held lock
+const loginLockPollInterval = 100 * time.Millisecond
+
 // TokenCache manages cached authentication tokens
 type TokenCache struct {
-	mu     sync.RWMutex
-	tokens map[string]*types.TokenInfo
-	path   string
+	mu          sync.RWMutex
+	tokens      map[string]*types.TokenInfo
+	path        string
+	store       Store
+	warn        func(error)
+	lockTimeout time.Duration
 }
 
-// NewTokenCache creates a new token cache instance
-func NewTokenCache() *TokenCache {
-	cacheDir, err := os.UserCacheDir()
-	if err != nil {
-		cacheDir = os.TempDir()
+// Option configures a TokenCache
+type Option func(*TokenCache)
+
+// WithStore sets the backend that persists the tokens. The default is a
+// plaintext file store in the cache directory.
+func WithStore(store Store) Option {
+	return func(c *TokenCache) {
+		c.store = store
+	}
+}
+
+// WithDir sets the directory holding the default file store and the login
+// lock files. The default is DefaultDir.
+func WithDir(dir string) Option {
+	return func(c *TokenCache) {
+		c.path = filepath.Join(dir, "tokens.json")
+	}
+}
+
+// WithWarnings sets a function called with the problems the cache recovers
+// from, such as a corrupt cache file that was quarantined
+func WithWarnings(warn func(error)) Option {
+	return func(c *TokenCache) {
+		c.warn = warn
 	}
+}
 
-	cachePath := filepath.Join(cacheDir, "kubectl-login", "tokens.json")
+// WithLoginLockTimeout sets how long LockLogin waits for a login in another
+// process. The default is DefaultLoginLockTimeout.
+func WithLoginLockTimeout(timeout time.Duration) Option {
+	return func(c *TokenCache) {
+		c.lockTimeout = timeout
+	}
+}
 
+// NewTokenCache creates a new token cache instance and loads the stored
+// tokens. It fails if the backend can't be read.
+func NewTokenCache(opts ...Option) (*TokenCache, error) {
 	cache := &TokenCache{
 		tokens: make(map[string]*types.TokenInfo),
-		path:   cachePath,
+	}
+	for _, opt := range opts {
+		opt(cache)
 	}
 
 	// Load existing cache
-	cache.load()
+	if err := cache.load(); err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+// DefaultDir returns the directory holding the token cache and its lock files:
+// kubectl-login in the user cache directory. Without a user cache directory,
+// it falls back to a per-user directory in the temp dir. The temp dir is shared
+// between users, and on CI runners between jobs, so the fallback is refused
+// unless that directory is private to the current user, which is never the
+// case on platforms where privacy can't be checked.
+func DefaultDir() (string, error) {
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(cacheDir, "kubectl-login"), nil
+	}
 
-	return cache
+	if !permissionsChecked {
+		return "", errors.New("no user cache directory, and a directory in the shared temp dir can't be checked to be private on this platform: use --cache-dir or --no-cache")
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("no user cache directory and failed to look up the current user: %w", err)
+	}
+	dir := filepath.Join(os.TempDir(), "kubectl-login-"+u.Uid)
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("no user cache directory and failed to create %s: %w", dir, err)
+	}
+
+	// The directory may have been created by someone else
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() || !isPrivate(info) {
+		return "", fmt.Errorf("no user cache directory and %s is not a directory private to the current user: use --cache-dir or --no-cache", dir)
+	}
+	return dir, nil
+}
+
+// Get retrieves a cached token. A key without a subject finds the token of
+// any user logged in with the same request, preferring the one that expires
+// last, which is the one most recently logged in or refreshed.
+func (c *TokenCache) Get(key Key) *types.TokenInfo {
+	_, token := c.Find(key)
+	return token
 }
 
-// Get retrieves a cached token
-func (c *TokenCache) Get(issuerURL, clientID string) *types.TokenInfo {
+// Find is Get that also returns the key the token is stored under
+func (c *TokenCache) Find(key Key) (Key, *types.TokenInfo) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	key := c.key(issuerURL, clientID)
-	return c.tokens[key]
+	if key.Subject != "" {
+		return key, c.tokens[key.String()]
+	}
+
+	var found Key
+	var token *types.TokenInfo
+	for s, candidate := range c.tokens {
+		stored := parseKey(s)
+		if !key.Matches(stored) {
+			continue
+		}
+		if token == nil || candidate.Expiry.After(token.Expiry) {
+			found, token = stored, candidate
+		}
+	}
+	return found, token
 }
 
-// Set stores a token in the cache
-func (c *TokenCache) Set(issuerURL, clientID string, token *types.TokenInfo) {
+// Set stores a token in the cache. Storing a token for a known subject
+// replaces the token stored for the same request before the subject was known.
+// If the token can't be persisted, it is still cached in memory and an error
+// is returned.
+func (c *TokenCache) Set(key Key, token *types.TokenInfo) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	key := c.key(issuerURL, clientID)
-	c.tokens[key] = token
+	c.tokens[key.String()] = token
 
-	// Persist to disk
-	c.save()
+	// Persist to the backend
+	store, err := c.backend()
+	if err != nil {
+		return fmt.Errorf("failed to save token cache: %w", err)
+	}
+	if err := store.Set(key, token); err != nil && !c.recovered(err) {
+		return fmt.Errorf("failed to save token cache: %w", err)
+	}
+
+	if key.Subject != "" {
+		if anonymous := key.Request(); c.tokens[anonymous.String()] != nil {
+			delete(c.tokens, anonymous.String())
+			if err := store.Delete(anonymous); err != nil && !c.recovered(err) {
+				return fmt.Errorf("failed to save token cache: %w", err)
+			}
+		}
+	}
+	return nil
 }
 
 // Clear removes a token from the cache
-func (c *TokenCache) Clear(issuerURL, clientID string) {
+func (c *TokenCache) Clear(key Key) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	key := c.key(issuerURL, clientID)
-	delete(c.tokens, key)
+	delete(c.tokens, key.String())
 
-	// Persist to disk
-	c.save()
+	// Persist to the backend
+	store, err := c.backend()
+	if err != nil {
+		return fmt.Errorf("failed to save token cache: %w", err)
+	}
+	if err := store.Delete(key); err != nil && !c.recovered(err) {
+		return fmt.Errorf("failed to save token cache: %w", err)
+	}
+	return nil
 }
 
-// key generates a cache key from issuer URL and client ID
-func (c *TokenCache) key(issuerURL, clientID string) string {
-	return issuerURL + ":" + clientID
+// Entry is a cached token and the key it is stored under
+type Entry struct {
+	Key   Key
+	Token *types.TokenInfo
 }
 
-// load reads the cache from disk
-func (c *TokenCache) load() {
-	data, err := os.ReadFile(c.path)
-	if err != nil {
-		// Cache file doesn't exist yet, that's okay
-		return
-	}
+// Entries returns all cached tokens, sorted by key
+func (c *TokenCache) Entries() []Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	var cacheData map[string]*cacheEntry
-	if err := json.Unmarshal(data, &cacheData); err != nil {
-		// Invalid cache file, ignore it
-		return
+	entries := make([]Entry, 0, len(c.tokens))
+	for _, s := range sortedKeys(c.tokens) {
+		entries = append(entries, Entry{Key: parseKey(s), Token: c.tokens[s]})
 	}
+	return entries
+}
+
+// Reload re-reads the cache from the backend, picking up tokens written by
+// other processes since the cache was loaded. If the backend can't be read,
+// the tokens loaded before are kept and an error is returned.
+func (c *TokenCache) Reload() error {
+	return c.load()
+}
 
+// LockLogin serializes logins for the request of key across processes, so
+// that concurrent kubectl invocations don't each start a browser flow. The
+// subject is ignored since the user is only known after the login. If another
+// process holds the lock, wait is called before blocking until it is released,
+// or failing with ErrLoginLockTimeout once the login lock timeout has passed.
+// Callers should Reload after acquiring the lock, since the other process has
+// usually cached a token by then.
+func (c *TokenCache) LockLogin(key Key, wait func()) (unlock func(), err error) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	path, err := c.filePath()
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
 
-	for key, entry := range cacheData {
-		c.tokens[key] = &types.TokenInfo{
-			AccessToken:  entry.AccessToken,
-			RefreshToken: entry.RefreshToken,
-			IDToken:      entry.IDToken,
-			Expiry:       entry.Expiry,
+	sum := sha256.Sum256([]byte(key.Request().String()))
+	lockPath := filepath.Join(filepath.Dir(path), "login-"+hex.EncodeToString(sum[:8])+".lock")
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := tryLockFile(f)
+	if err == nil && !locked {
+		if wait != nil {
+			wait()
+		}
+		timeout := c.lockTimeout
+		if timeout <= 0 {
+			timeout = DefaultLoginLockTimeout
+		}
+		deadline := time.Now().Add(timeout)
+		for err == nil && !locked && time.Now().Before(deadline) {
+			time.Sleep(loginLockPollInterval)
+			locked, err = tryLockFile(f)
 		}
+		if err == nil && !locked {
+			err = fmt.Errorf("%w after %s", ErrLoginLockTimeout, timeout)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
 	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
 }
 
-// save writes the cache to disk
-func (c *TokenCache) save() {
-	cacheDir := filepath.Dir(c.path)
-	if err := os.MkdirAll(cacheDir, 0700); err != nil {
-		// Failed to create cache directory, skip saving
-		return
+// backend returns the store, defaulting to the plaintext file at c.path.
+// Callers must hold c.mu for writing.
+func (c *TokenCache) backend() (Store, error) {
+	if c.store == nil {
+		path, err := c.filePath()
+		if err != nil {
+			return nil, err
+		}
+		c.store = NewFileStore(path)
 	}
+	return c.store, nil
+}
 
-	cacheData := make(map[string]*cacheEntry)
-	for key, token := range c.tokens {
-		cacheData[key] = &cacheEntry{
-			AccessToken:  token.AccessToken,
-			RefreshToken: token.RefreshToken,
-			IDToken:      token.IDToken,
-			Expiry:       token.Expiry,
+// filePath returns the path of the default file store, which also locates
+// the lock files. Callers must hold c.mu for writing.
+func (c *TokenCache) filePath() (string, error) {
+	if c.path == "" {
+		dir, err := DefaultDir()
+		if err != nil {
+			return "", err
 		}
+		c.path = filepath.Join(dir, "tokens.json")
 	}
+	return c.path, nil
+}
+
+// load reads all tokens from the backend in one read
+func (c *TokenCache) load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	data, err := json.MarshalIndent(cacheData, "", "  ")
+	store, err := c.backend()
 	if err != nil {
-		// Failed to marshal, skip saving
-		return
+		return fmt.Errorf("failed to read token cache: %w", err)
+	}
+	entries, err := store.All()
+	if err != nil && !c.recovered(err) {
+		// Unreadable cache, keep what we have
+		return fmt.Errorf("failed to read token cache: %w", err)
 	}
 
-	// Write to temporary file first, then rename (atomic operation)
-	tmpPath := c.path + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
-		return
+	tokens := make(map[string]*types.TokenInfo, len(entries))
+	for _, entry := range entries {
+		tokens[entry.Key.String()] = entry.Token
 	}
+	c.tokens = tokens
+	return nil
+}
 
-	os.Rename(tmpPath, c.path)
+// recovered reports whether err is a problem the backend recovered from, and
+// if so passes it to the warning function
+func (c *TokenCache) recovered(err error) bool {
+	var corrupt *CorruptError
+	var unlocked *UnlockedError
+	if !errors.As(err, &corrupt) && !errors.As(err, &unlocked) {
+		return false
+	}
+	if c.warn != nil {
+		c.warn(err)
+	}
+	return true
 }
 
 // cacheEntry is used for JSON serialization
@@ -142,3 +353,21 @@ type cacheEntry struct {
 	IDToken      string    `json:"id_token"`
 	Expiry       time.Time `json:"expiry"`
 }
+
+func newCacheEntry(token *types.TokenInfo) *cacheEntry {
+	return &cacheEntry{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		IDToken:      token.IDToken,
+		Expiry:       token.Expiry,
+	}
+}
+
+func (e *cacheEntry) token() *types.TokenInfo {
+	return &types.TokenInfo{
+		AccessToken:  e.AccessToken,
+		RefreshToken: e.RefreshToken,
+		IDToken:      e.IDToken,
+		Expiry:       e.Expiry,
+	}
+}
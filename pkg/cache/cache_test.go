@@ -1,16 +1,20 @@
 package cache
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
 	"github.com/chinnareddy578/kubectl-login/pkg/types"
 )
 
 func TestTokenCache_GetSet(t *testing.T) {
-	tmpDir := t.TempDir()
+	tmpDir := privateTempDir(t)
 	cachePath := filepath.Join(tmpDir, "tokens.json")
 
 	cache := &TokenCache{
@@ -29,10 +33,10 @@ func TestTokenCache_GetSet(t *testing.T) {
 	}
 
 	// Test Set
-	cache.Set(issuerURL, clientID, token)
+	cache.Set(Key{IssuerURL: issuerURL, ClientID: clientID}, token)
 
 	// Test Get
-	retrieved := cache.Get(issuerURL, clientID)
+	retrieved := cache.Get(Key{IssuerURL: issuerURL, ClientID: clientID})
 	if retrieved == nil {
 		t.Fatal("Expected token to be cached")
 	}
@@ -49,7 +53,7 @@ func TestTokenCache_GetSet(t *testing.T) {
 }
 
 func TestTokenCache_Clear(t *testing.T) {
-	tmpDir := t.TempDir()
+	tmpDir := privateTempDir(t)
 	cachePath := filepath.Join(tmpDir, "tokens.json")
 
 	cache := &TokenCache{
@@ -65,24 +69,24 @@ func TestTokenCache_Clear(t *testing.T) {
 		Expiry:      time.Now().Add(1 * time.Hour),
 	}
 
-	cache.Set(issuerURL, clientID, token)
+	cache.Set(Key{IssuerURL: issuerURL, ClientID: clientID}, token)
 
 	// Verify it's cached
-	if cache.Get(issuerURL, clientID) == nil {
+	if cache.Get(Key{IssuerURL: issuerURL, ClientID: clientID}) == nil {
 		t.Fatal("Token should be cached")
 	}
 
 	// Clear it
-	cache.Clear(issuerURL, clientID)
+	cache.Clear(Key{IssuerURL: issuerURL, ClientID: clientID})
 
 	// Verify it's gone
-	if cache.Get(issuerURL, clientID) != nil {
+	if cache.Get(Key{IssuerURL: issuerURL, ClientID: clientID}) != nil {
 		t.Error("Token should be cleared")
 	}
 }
 
 func TestTokenCache_Persistence(t *testing.T) {
-	tmpDir := t.TempDir()
+	tmpDir := privateTempDir(t)
 	cachePath := filepath.Join(tmpDir, "tokens.json")
 
 	issuerURL := "https://test-issuer.com"
@@ -100,7 +104,7 @@ func TestTokenCache_Persistence(t *testing.T) {
 		tokens: make(map[string]*types.TokenInfo),
 		path:   cachePath,
 	}
-	cache1.Set(issuerURL, clientID, token)
+	cache1.Set(Key{IssuerURL: issuerURL, ClientID: clientID}, token)
 
 	// Create second cache instance and load
 	cache2 := &TokenCache{
@@ -110,7 +114,7 @@ func TestTokenCache_Persistence(t *testing.T) {
 	cache2.load()
 
 	// Verify token was persisted
-	retrieved := cache2.Get(issuerURL, clientID)
+	retrieved := cache2.Get(Key{IssuerURL: issuerURL, ClientID: clientID})
 	if retrieved == nil {
 		t.Fatal("Expected token to be persisted")
 	}
@@ -121,7 +125,7 @@ func TestTokenCache_Persistence(t *testing.T) {
 }
 
 func TestTokenCache_InvalidFile(t *testing.T) {
-	tmpDir := t.TempDir()
+	tmpDir := privateTempDir(t)
 	cachePath := filepath.Join(tmpDir, "invalid.json")
 
 	// Write invalid JSON
@@ -144,7 +148,7 @@ func TestTokenCache_InvalidFile(t *testing.T) {
 }
 
 func TestTokenCache_ConcurrentAccess(t *testing.T) {
-	tmpDir := t.TempDir()
+	tmpDir := privateTempDir(t)
 	cachePath := filepath.Join(tmpDir, "tokens.json")
 
 	cache := &TokenCache{
@@ -163,7 +167,7 @@ func TestTokenCache_ConcurrentAccess(t *testing.T) {
 				AccessToken: "token-" + string(rune(id)),
 				Expiry:      time.Now().Add(1 * time.Hour),
 			}
-			cache.Set(issuerURL, clientID, token)
+			cache.Set(Key{IssuerURL: issuerURL, ClientID: clientID}, token)
 			done <- true
 		}(i)
 	}
@@ -174,20 +178,15 @@ func TestTokenCache_ConcurrentAccess(t *testing.T) {
 	}
 
 	// Should not panic and should have a token
-	if cache.Get(issuerURL, clientID) == nil {
+	if cache.Get(Key{IssuerURL: issuerURL, ClientID: clientID}) == nil {
 		t.Error("Expected token after concurrent writes")
 	}
 }
 
 func TestTokenCache_KeyGeneration(t *testing.T) {
-	cache := &TokenCache{
-		tokens: make(map[string]*types.TokenInfo),
-		path:   "/tmp/test",
-	}
-
-	key1 := cache.key("https://issuer1.com", "client1")
-	key2 := cache.key("https://issuer2.com", "client1")
-	key3 := cache.key("https://issuer1.com", "client2")
+	key1 := Key{IssuerURL: "https://issuer1.com", ClientID: "client1"}.String()
+	key2 := Key{IssuerURL: "https://issuer2.com", ClientID: "client1"}.String()
+	key3 := Key{IssuerURL: "https://issuer1.com", ClientID: "client2"}.String()
 
 	if key1 == key2 {
 		t.Error("Different issuers should generate different keys")
@@ -200,3 +199,224 @@ func TestTokenCache_KeyGeneration(t *testing.T) {
 	}
 }
 
+func TestTokenCache_MergesConcurrentWriters(t *testing.T) {
+	cachePath := filepath.Join(privateTempDir(t), "tokens.json")
+
+	// Both instances load the (empty) cache before either writes, like two
+	// kubectl invocations starting at the same time
+	cache1 := &TokenCache{tokens: make(map[string]*types.TokenInfo), path: cachePath}
+	cache2 := &TokenCache{tokens: make(map[string]*types.TokenInfo), path: cachePath}
+	cache1.load()
+	cache2.load()
+
+	cache1.Set(Key{IssuerURL: "https://issuer-a.com", ClientID: "client"}, &types.TokenInfo{AccessToken: "token-a"})
+	cache2.Set(Key{IssuerURL: "https://issuer-b.com", ClientID: "client"}, &types.TokenInfo{AccessToken: "token-b"})
+
+	cache3 := &TokenCache{tokens: make(map[string]*types.TokenInfo), path: cachePath}
+	cache3.load()
+	if got := cache3.Get(Key{IssuerURL: "https://issuer-a.com", ClientID: "client"}); got == nil || got.AccessToken != "token-a" {
+		t.Errorf("entry written by the first instance was lost: %+v", got)
+	}
+	if got := cache3.Get(Key{IssuerURL: "https://issuer-b.com", ClientID: "client"}); got == nil || got.AccessToken != "token-b" {
+		t.Errorf("entry written by the second instance was lost: %+v", got)
+	}
+
+	// Clearing an entry keeps the other process's entries too
+	cache1.Clear(Key{IssuerURL: "https://issuer-a.com", ClientID: "client"})
+	cache3.Reload()
+	if cache3.Get(Key{IssuerURL: "https://issuer-a.com", ClientID: "client"}) != nil {
+		t.Error("cleared entry should be gone after reload")
+	}
+	if cache3.Get(Key{IssuerURL: "https://issuer-b.com", ClientID: "client"}) == nil {
+		t.Error("clearing one entry should keep the others")
+	}
+}
+
+func TestTokenCache_LockLoginWaits(t *testing.T) {
+	cachePath := filepath.Join(privateTempDir(t), "tokens.json")
+	cache1 := &TokenCache{tokens: make(map[string]*types.TokenInfo), path: cachePath}
+	cache2 := &TokenCache{tokens: make(map[string]*types.TokenInfo), path: cachePath}
+
+	unlock, err := cache1.LockLogin(Key{IssuerURL: "https://issuer.com", ClientID: "client"}, nil)
+	if err != nil {
+		t.Fatalf("LockLogin failed: %v", err)
+	}
+
+	waited := make(chan struct{})
+	acquired := make(chan struct{})
+	go func() {
+		unlock2, err := cache2.LockLogin(Key{IssuerURL: "https://issuer.com", ClientID: "client"}, func() { close(waited) })
+		if err != nil {
+			t.Errorf("second LockLogin failed: %v", err)
+			close(acquired)
+			return
+		}
+		// The first login finished while we waited
+		cache2.Reload()
+		if cache2.Get(Key{IssuerURL: "https://issuer.com", ClientID: "client"}) == nil {
+			t.Error("expected the token cached by the first login")
+		}
+		unlock2()
+		close(acquired)
+	}()
+
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second LockLogin should report that it is waiting")
+	}
+	select {
+	case <-acquired:
+		t.Fatal("second LockLogin should block while the first holds the lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cache1.Set(Key{IssuerURL: "https://issuer.com", ClientID: "client"}, &types.TokenInfo{AccessToken: "token"})
+	unlock()
+
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second LockLogin should acquire the lock once released")
+	}
+
+	// Logins for other clients are not serialized
+	unlock3, err := cache1.LockLogin(Key{IssuerURL: "https://issuer.com", ClientID: "other-client"}, func() {
+		t.Error("a different client should not wait")
+	})
+	if err != nil {
+		t.Fatalf("LockLogin failed: %v", err)
+	}
+	unlock3()
+}
+
+func TestTokenCache_LockLoginTimeout(t *testing.T) {
+	// Waiting processes must outlast the login they wait for
+	if DefaultLoginLockTimeout <= config.LoginTimeout {
+		t.Errorf("DefaultLoginLockTimeout %s should exceed the login timeout %s", DefaultLoginLockTimeout, config.LoginTimeout)
+	}
+
+	cachePath := filepath.Join(privateTempDir(t), "tokens.json")
+	key := Key{IssuerURL: "https://issuer.com", ClientID: "client"}
+	cache1 := &TokenCache{tokens: make(map[string]*types.TokenInfo), path: cachePath}
+	cache2 := &TokenCache{tokens: make(map[string]*types.TokenInfo), path: cachePath, lockTimeout: 200 * time.Millisecond}
+
+	unlock, err := cache1.LockLogin(key, nil)
+	if err != nil {
+		t.Fatalf("LockLogin failed: %v", err)
+	}
+	defer unlock()
+
+	// An abandoned login in another process doesn't block forever
+	if _, err := cache2.LockLogin(key, nil); !errors.Is(err, ErrLoginLockTimeout) {
+		t.Errorf("expected ErrLoginLockTimeout, got %v", err)
+	}
+}
+
+func TestTokenCache_WarnsWhenUnlocked(t *testing.T) {
+	cachePath := filepath.Join(privateTempDir(t), "tokens.json")
+	// A directory where the lock file should be makes locking fail
+	if err := os.Mkdir(cachePath+".lock", 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	var warnings []error
+	cache, err := NewTokenCache(WithStore(NewFileStore(cachePath)), WithWarnings(func(err error) {
+		warnings = append(warnings, err)
+	}))
+	if err != nil {
+		t.Fatalf("NewTokenCache failed: %v", err)
+	}
+	if err := cache.Set(Key{IssuerURL: "https://issuer.com", ClientID: "client"}, &types.TokenInfo{AccessToken: "token"}); err != nil {
+		t.Fatalf("Set should succeed without the lock: %v", err)
+	}
+
+	var unlocked *UnlockedError
+	if len(warnings) == 0 || !errors.As(warnings[len(warnings)-1], &unlocked) {
+		t.Errorf("expected an UnlockedError warning, got %v", warnings)
+	}
+}
+
+func TestTokenCache_QuarantinesCorruptFile(t *testing.T) {
+	cachePath := filepath.Join(privateTempDir(t), "tokens.json")
+	if err := os.WriteFile(cachePath, []byte("{truncated"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var warnings []error
+	cache, err := NewTokenCache(WithStore(NewFileStore(cachePath)), WithWarnings(func(err error) {
+		warnings = append(warnings, err)
+	}))
+	if err != nil {
+		t.Fatalf("a corrupt cache should not be fatal: %v", err)
+	}
+
+	var corrupt *CorruptError
+	if len(warnings) != 1 || !errors.As(warnings[0], &corrupt) {
+		t.Fatalf("expected one CorruptError warning, got %v", warnings)
+	}
+	if data, err := os.ReadFile(corrupt.Quarantined); err != nil || string(data) != "{truncated" {
+		t.Errorf("corrupt file should be kept at %s: %q, %v", corrupt.Quarantined, data, err)
+	}
+
+	// The cache starts over
+	if err := cache.Set(Key{IssuerURL: "https://issuer.com", ClientID: "client"}, &types.TokenInfo{AccessToken: "token"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if keys, err := NewFileStore(cachePath).List(); err != nil || len(keys) != 1 {
+		t.Errorf("expected a fresh cache with one entry, got %v, %v", keys, err)
+	}
+}
+
+func TestTokenCache_ReportsErrors(t *testing.T) {
+	// A file where the cache directory should be makes every operation fail
+	notDir := filepath.Join(privateTempDir(t), "not-a-dir")
+	if err := os.WriteFile(notDir, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cachePath := filepath.Join(notDir, "tokens.json")
+
+	if _, err := NewTokenCache(WithStore(NewFileStore(cachePath))); err == nil {
+		t.Error("NewTokenCache should fail when the cache can't be read")
+	}
+
+	cache := &TokenCache{tokens: make(map[string]*types.TokenInfo), path: cachePath}
+	key := Key{IssuerURL: "https://issuer.com", ClientID: "client"}
+	if err := cache.Set(key, &types.TokenInfo{AccessToken: "token"}); err == nil {
+		t.Error("Set should fail when the cache can't be written")
+	}
+	// The token is still usable by this process
+	if cache.Get(key) == nil {
+		t.Error("token should be cached in memory even if it can't be saved")
+	}
+}
+
+func TestDefaultDir_TempFallback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the temp dir fallback is only checked on unix")
+	}
+	// Without HOME there is no user cache directory
+	tmp := privateTempDir(t)
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("HOME", "")
+	t.Setenv("TMPDIR", tmp)
+
+	dir, err := DefaultDir()
+	if err != nil {
+		t.Fatalf("DefaultDir failed: %v", err)
+	}
+	if want := filepath.Join(tmp, fmt.Sprintf("kubectl-login-%d", os.Getuid())); dir != want {
+		t.Errorf("expected %s, got %s", want, dir)
+	}
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("expected a 0700 directory, got %v, %v", info, err)
+	}
+
+	// A directory others can access, e.g. created by another job, is refused
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DefaultDir(); err == nil {
+		t.Error("DefaultDir should refuse a temp dir others can access")
+	}
+}
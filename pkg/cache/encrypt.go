@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// keySize is the AES-256 key length in bytes
+const keySize = 32
+
+// scrypt parameters for passphrase-derived keys
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ErrDecrypt is returned when the cache file can't be decrypted with the
+// configured passphrase or key file
+var ErrDecrypt = errors.New("failed to decrypt token cache: wrong passphrase or key")
+
+// errNotEncrypted is returned when the cache file is not an encrypted cache file
+var errNotEncrypted = errors.New("not an encrypted cache file")
+
+// EncryptionKey derives the AES-256 key for an encrypted cache file from the
+// file's salt
+type EncryptionKey func(salt []byte) ([]byte, error)
+
+// PassphraseKey derives the key from passphrase with scrypt
+func PassphraseKey(passphrase string) EncryptionKey {
+	return func(salt []byte) ([]byte, error) {
+		return scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keySize)
+	}
+}
+
+// KeyFile reads a 32-byte key from path, stored either raw or base64-encoded
+// (as written by `openssl rand -base64 32`). The salt is not used.
+func KeyFile(path string) (EncryptionKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache key file: %w", err)
+	}
+
+	key := data
+	if len(key) != keySize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(decoded) != keySize {
+			return nil, fmt.Errorf("cache key file %s must contain %d bytes, raw or base64-encoded", path, keySize)
+		}
+		key = decoded
+	}
+
+	return func(salt []byte) ([]byte, error) {
+		return key, nil
+	}, nil
+}
+
+// sealedFile is the on-disk format of an encrypted cache file
+type sealedFile struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// fileCipher seals and opens cache files. It keeps the salt of the file it
+// last opened so that the derived key can be reused on write.
+type fileCipher struct {
+	mu   sync.Mutex
+	key  EncryptionKey
+	salt []byte
+	aead cipher.AEAD
+}
+
+func newFileCipher(key EncryptionKey) *fileCipher {
+	return &fileCipher{key: key}
+}
+
+// open decrypts the content of an encrypted cache file
+func (c *fileCipher) open(data []byte) ([]byte, error) {
+	var sealed sealedFile
+	if err := json.Unmarshal(data, &sealed); err != nil || sealed.Version != 1 {
+		return nil, errNotEncrypted
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	aead, err := c.aeadFor(sealed.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	plaintext, err := aead.Open(nil, sealed.Nonce, sealed.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// seal encrypts plaintext into the content of an encrypted cache file
+func (c *fileCipher) seal(plaintext []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	salt := c.salt
+	if salt == nil {
+		salt = make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+	}
+
+	aead, err := c.aeadFor(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&sealedFile{
+		Version:    1,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+	})
+}
+
+// aeadFor returns the AES-GCM cipher for salt, deriving the key only when the
+// salt changes. Callers must hold c.mu.
+func (c *fileCipher) aeadFor(salt []byte) (cipher.AEAD, error) {
+	if c.aead != nil && string(salt) == string(c.salt) {
+		return c.aead, nil
+	}
+
+	key, err := c.key(salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	c.salt = salt
+	c.aead = aead
+	return aead, nil
+}
@@ -0,0 +1,316 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+// cacheVersion is the version of the cache file format written by FileStore
+const cacheVersion = 2
+
+// errNewerVersion is returned for cache files written by a newer release
+var errNewerVersion = errors.New("token cache was written by a newer version of kubectl-login")
+
+// CorruptError is returned when the cache file can't be parsed. The file has
+// been moved aside to Quarantined, so that it can be inspected or recovered,
+// and the operation completed on an empty cache.
+type CorruptError struct {
+	Path        string
+	Quarantined string
+	Err         error
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("token cache %s is corrupt and was moved to %s: %v", e.Path, e.Quarantined, e.Err)
+}
+
+func (e *CorruptError) Unwrap() error {
+	return e.Err
+}
+
+// UnlockedError is returned when the lock file of the cache can't be taken.
+// The operation was completed without the lock, so a concurrent process may
+// have overwritten its changes.
+type UnlockedError struct {
+	Path string
+	Err  error
+}
+
+func (e *UnlockedError) Error() string {
+	return fmt.Sprintf("token cache %s was accessed without a lock: %v", e.Path, e.Err)
+}
+
+func (e *UnlockedError) Unwrap() error {
+	return e.Err
+}
+
+// cacheFile is the cache file layout
+type cacheFile struct {
+	Version int            `json:"version"`
+	Entries []*storedEntry `json:"entries"`
+}
+
+// FileStore keeps tokens in a JSON file. Every operation re-reads the file
+// under an advisory lock, so concurrent processes don't overwrite each other's
+// entries. With an encryption key the file content is sealed with AES-GCM.
+type FileStore struct {
+	path   string
+	cipher *fileCipher
+}
+
+// NewFileStore creates a store backed by the plaintext JSON file at path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// NewEncryptedFileStore creates a store backed by an AES-GCM encrypted file at
+// path, using key to derive the encryption key
+func NewEncryptedFileStore(path string, key EncryptionKey) *FileStore {
+	return &FileStore{path: path, cipher: newFileCipher(key)}
+}
+
+// Path returns the file backing the store
+func (s *FileStore) Path() string {
+	return s.path
+}
+
+// Get returns the token stored under key
+func (s *FileStore) Get(key Key) (*types.TokenInfo, error) {
+	var token *types.TokenInfo
+	err := withFileLock(s.path, func() error {
+		entries, err := s.read()
+		if entry, ok := entries[key.String()]; ok {
+			token = entry.token()
+		}
+		return err
+	})
+	return token, err
+}
+
+// Set stores token under key
+func (s *FileStore) Set(key Key, token *types.TokenInfo) error {
+	return s.update(func(entries map[string]*storedEntry) {
+		entries[key.String()] = newStoredEntry(key, token)
+	})
+}
+
+// Delete removes the token stored under key
+func (s *FileStore) Delete(key Key) error {
+	return s.update(func(entries map[string]*storedEntry) {
+		delete(entries, key.String())
+	})
+}
+
+// List returns the stored keys in sorted order
+func (s *FileStore) List() ([]Key, error) {
+	entries, err := s.All()
+	return entryKeys(entries), err
+}
+
+// All returns the stored tokens sorted by key, reading the file once
+func (s *FileStore) All() ([]Entry, error) {
+	var entries []Entry
+	err := withFileLock(s.path, func() error {
+		stored, err := s.read()
+		entries = sortedEntries(stored)
+		return err
+	})
+	return entries, err
+}
+
+// update re-reads the file under the lock, applies modify and writes it back.
+// A file that can't be read is left alone, unless it is corrupt and has been
+// quarantined, in which case update starts over and reports the CorruptError.
+func (s *FileStore) update(modify func(map[string]*storedEntry)) error {
+	return withFileLock(s.path, func() error {
+		entries, readErr := s.read()
+		var corrupt *CorruptError
+		if readErr != nil && !errors.As(readErr, &corrupt) {
+			// Don't overwrite tokens we can't read
+			return readErr
+		}
+		modify(entries)
+		if err := s.write(entries); err != nil {
+			return err
+		}
+		return readErr
+	})
+}
+
+// read parses the cache file into entries indexed by the canonical key. A
+// missing file is an empty cache. Files in the version 1 format, a flat map
+// from "issuerURL:clientID" to token, are migrated. The file and its directory
+// must be private to the current user.
+func (s *FileStore) read() (map[string]*storedEntry, error) {
+	entries := make(map[string]*storedEntry)
+
+	for _, path := range []string{filepath.Dir(s.path), s.path} {
+		if err := checkPrivate(path); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		// Cache file doesn't exist yet, that's okay
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cipher != nil {
+		if data, err = s.cipher.open(data); errors.Is(err, errNotEncrypted) {
+			return s.quarantine(err)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return s.quarantine(err)
+	}
+
+	if _, ok := fields["version"]; !ok {
+		var legacy map[string]*cacheEntry
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return s.quarantine(err)
+		}
+		for key, entry := range legacy {
+			stored := &storedEntry{Key: legacyKey(key), cacheEntry: *entry}
+			entries[stored.Key.String()] = stored
+		}
+		return entries, nil
+	}
+
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return s.quarantine(err)
+	}
+	if file.Version > cacheVersion {
+		return nil, fmt.Errorf("%w (version %d)", errNewerVersion, file.Version)
+	}
+	for _, entry := range file.Entries {
+		entries[entry.Key.String()] = entry
+	}
+	return entries, nil
+}
+
+// quarantine moves the corrupt cache file aside and returns an empty cache
+// with a CorruptError. If the file can't be moved, it is left in place and
+// the parse error is returned instead.
+func (s *FileStore) quarantine(parseErr error) (map[string]*storedEntry, error) {
+	quarantined := s.path + ".corrupt-" + time.Now().UTC().Format("20060102T150405Z")
+	if err := os.Rename(s.path, quarantined); err != nil {
+		return nil, fmt.Errorf("token cache %s is corrupt: %w", s.path, parseErr)
+	}
+	return make(map[string]*storedEntry), &CorruptError{Path: s.path, Quarantined: quarantined, Err: parseErr}
+}
+
+// write replaces the cache file with entries
+func (s *FileStore) write(entries map[string]*storedEntry) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	file := cacheFile{Version: cacheVersion, Entries: make([]*storedEntry, 0, len(entries))}
+	for _, key := range sortedKeys(entries) {
+		file.Entries = append(file.Entries, entries[key])
+	}
+
+	data, err := json.MarshalIndent(&file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if s.cipher != nil {
+		if data, err = s.cipher.seal(data); err != nil {
+			return err
+		}
+	}
+
+	// Write to temporary file first, then rename (atomic operation)
+	tmpPath := s.path + ".tmp"
+	if err := writeFileSync(tmpPath, data); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
+
+// writeFileSync writes data to a new file at path with 0600 permissions and
+// flushes it to disk, so that a crash after renaming it can't leave a
+// truncated file behind
+func writeFileSync(path string, data []byte) error {
+	// A leftover file could have looser permissions
+	os.Remove(path)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// withFileLock runs fn while holding the advisory lock for the file at path.
+// If the lock can't be taken, fn runs unlocked and, if it succeeds, an
+// UnlockedError is returned.
+func withFileLock(path string, fn func() error) error {
+	unlock, lockErr := lockPath(path + ".lock")
+	if lockErr != nil {
+		if err := fn(); err != nil {
+			return err
+		}
+		return &UnlockedError{Path: path, Err: lockErr}
+	}
+	defer unlock()
+
+	return fn()
+}
+
+// lockPath takes the advisory lock on the lock file at path, creating it and
+// its directory if needed
+func lockPath(path string) (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// sortedKeys returns the sorted keys of a map
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+)
+
+// Key identifies a cached token: the login request that produced it and the
+// identity it was issued to. Tokens requested with different scopes, auth
+// params, token type or login hint, or issued to different users, are cached
+// separately.
+type Key struct {
+	IssuerURL  string            `json:"issuer_url"`
+	ClientID   string            `json:"client_id"`
+	Scopes     []string          `json:"scopes,omitempty"`
+	AuthParams map[string]string `json:"auth_params,omitempty"`
+	TokenType  string            `json:"token_type,omitempty"`
+	// LoginHint is the account requested with config.Config.LoginHint, which
+	// selects between the tokens of several users of the same request
+	LoginHint string `json:"login_hint,omitempty"`
+	// Subject is the sub claim of the logged-in user. It is empty until the
+	// user has logged in.
+	Subject string `json:"subject,omitempty"`
+}
+
+// NewKey returns the key for the login request described by cfg, without a
+// subject. Scopes default to config.DefaultScopes and are sorted, so that the
+// order they are listed in doesn't matter.
+func NewKey(cfg *config.Config) Key {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = config.DefaultScopes
+	}
+	tokenType := cfg.TokenType
+	if tokenType == "" {
+		tokenType = config.TokenTypeIDToken
+	}
+
+	key := Key{
+		IssuerURL: cfg.IssuerURL,
+		ClientID:  cfg.ClientID,
+		Scopes:    normalizeScopes(scopes),
+		TokenType: tokenType,
+		LoginHint: cfg.LoginHint,
+	}
+	if len(cfg.AuthParams) > 0 {
+		key.AuthParams = make(map[string]string, len(cfg.AuthParams))
+		for k, v := range cfg.AuthParams {
+			key.AuthParams[k] = v
+		}
+	}
+	return key
+}
+
+// WithSubject returns a copy of k for the user identified by subject
+func (k Key) WithSubject(subject string) Key {
+	k.Subject = subject
+	return k
+}
+
+// Request returns k without its subject
+func (k Key) Request() Key {
+	return k.WithSubject("")
+}
+
+// Matches reports whether k identifies other. A key without a subject matches
+// the tokens of every user logged in with the same request.
+func (k Key) Matches(other Key) bool {
+	if k.Subject != "" && k.Subject != other.Subject {
+		return false
+	}
+	return k.Request().String() == other.Request().String()
+}
+
+// String returns the canonical form of k, used to compare keys and as the
+// key of stores that index by string
+func (k Key) String() string {
+	k.Scopes = normalizeScopes(k.Scopes)
+	// Maps are marshaled with sorted keys, so the encoding is canonical
+	data, _ := json.Marshal(k)
+	return string(data)
+}
+
+// parseKey parses the canonical form returned by Key.String
+func parseKey(s string) Key {
+	var key Key
+	json.Unmarshal([]byte(s), &key)
+	return key
+}
+
+// legacyKey converts an "issuerURL:clientID" key of the version 1 cache
+// format. Those tokens were requested with the default settings.
+func legacyKey(s string) Key {
+	issuerURL, clientID := s, ""
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		issuerURL, clientID = s[:i], s[i+1:]
+	}
+	return NewKey(&config.Config{IssuerURL: issuerURL, ClientID: clientID})
+}
+
+// normalizeScopes returns the sorted scopes without duplicates
+func normalizeScopes(scopes []string) []string {
+	if len(scopes) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), scopes...)
+	sort.Strings(sorted)
+
+	unique := sorted[:1]
+	for _, scope := range sorted[1:] {
+		if scope != unique[len(unique)-1] {
+			unique = append(unique, scope)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+func TestNewKey(t *testing.T) {
+	key := NewKey(&config.Config{IssuerURL: "https://issuer.com", ClientID: "client"})
+	if !reflect.DeepEqual(key.Scopes, []string{"email", "offline_access", "openid", "profile"}) {
+		t.Errorf("expected the sorted default scopes, got %v", key.Scopes)
+	}
+	if key.TokenType != config.TokenTypeIDToken {
+		t.Errorf("expected the default token type, got %q", key.TokenType)
+	}
+
+	// Scope order and duplicates don't matter
+	a := NewKey(&config.Config{IssuerURL: "https://issuer.com", ClientID: "client", Scopes: []string{"openid", "groups"}})
+	b := NewKey(&config.Config{IssuerURL: "https://issuer.com", ClientID: "client", Scopes: []string{"groups", "openid", "groups"}})
+	if a.String() != b.String() {
+		t.Errorf("expected equal keys, got %s and %s", a, b)
+	}
+
+	base := config.Config{IssuerURL: "https://issuer.com", ClientID: "client"}
+	variants := map[string]config.Config{
+		"scopes":      {IssuerURL: base.IssuerURL, ClientID: base.ClientID, Scopes: []string{"openid"}},
+		"auth params": {IssuerURL: base.IssuerURL, ClientID: base.ClientID, AuthParams: map[string]string{"audience": "prod"}},
+		"token type":  {IssuerURL: base.IssuerURL, ClientID: base.ClientID, TokenType: config.TokenTypeAccessToken},
+		"login hint":  {IssuerURL: base.IssuerURL, ClientID: base.ClientID, LoginHint: "breakglass@example.com"},
+	}
+	for name, cfg := range variants {
+		cfg := cfg
+		if NewKey(&cfg).String() == NewKey(&base).String() {
+			t.Errorf("keys differing in %s should be different", name)
+		}
+	}
+
+	if key.WithSubject("alice").String() == key.WithSubject("bob").String() {
+		t.Error("keys of different subjects should be different")
+	}
+}
+
+func TestKey_Matches(t *testing.T) {
+	request := NewKey(&config.Config{IssuerURL: "https://issuer.com", ClientID: "client"})
+	alice := request.WithSubject("alice")
+
+	if !request.Matches(alice) {
+		t.Error("a key without subject should match every subject")
+	}
+	if !alice.Matches(alice) || alice.Matches(request.WithSubject("bob")) {
+		t.Error("a key with subject should only match that subject")
+	}
+	if request.Matches(Key{IssuerURL: "https://issuer.com", ClientID: "other"}.WithSubject("alice")) {
+		t.Error("keys of different requests should not match")
+	}
+}
+
+func TestFileStore_MigratesVersion1(t *testing.T) {
+	path := filepath.Join(privateTempDir(t), "tokens.json")
+	legacy := `{
+  "https://issuer.com:client": {
+    "access_token": "legacy-access",
+    "refresh_token": "legacy-refresh",
+    "id_token": "",
+    "expiry": "2030-01-01T00:00:00Z"
+  }
+}`
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewFileStore(path)
+	keys, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	want := NewKey(&config.Config{IssuerURL: "https://issuer.com", ClientID: "client"})
+	if len(keys) != 1 || keys[0].String() != want.String() {
+		t.Fatalf("expected the legacy entry under %s, got %v", want, keys)
+	}
+
+	// The first write converts the file to the current format
+	if err := store.Set(testKey("other"), &types.TokenInfo{AccessToken: "new"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("failed to parse migrated file: %v", err)
+	}
+	if file.Version != cacheVersion || len(file.Entries) != 2 {
+		t.Errorf("expected version %d with 2 entries, got version %d with %d", cacheVersion, file.Version, len(file.Entries))
+	}
+	if got, _ := store.Get(want); got == nil || got.RefreshToken != "legacy-refresh" {
+		t.Errorf("legacy token lost in migration: %+v", got)
+	}
+}
+
+func TestFileStore_NewerVersion(t *testing.T) {
+	path := filepath.Join(privateTempDir(t), "tokens.json")
+	newer := []byte(`{"version": 99, "entries": []}`)
+	os.WriteFile(path, newer, 0600)
+
+	store := NewFileStore(path)
+	if _, err := store.List(); err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Errorf("expected a newer version error, got %v", err)
+	}
+	if err := store.Set(testKey("a"), &types.TokenInfo{}); err == nil {
+		t.Error("Set should not overwrite a cache written by a newer version")
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(newer) {
+		t.Error("cache file written by a newer version was modified")
+	}
+}
+
+func TestTokenCache_Subjects(t *testing.T) {
+	cache, _ := NewTokenCache(WithStore(NewMemoryStore()))
+	request := NewKey(&config.Config{IssuerURL: "https://issuer.com", ClientID: "client"})
+
+	// A token stored before the subject is known is found by the request
+	cache.Set(request, &types.TokenInfo{AccessToken: "anonymous"})
+	if got := cache.Get(request); got == nil || got.AccessToken != "anonymous" {
+		t.Fatalf("expected the anonymous token, got %+v", got)
+	}
+
+	// ...and replaced once the subject is known
+	now := time.Now()
+	cache.Set(request.WithSubject("personal"), &types.TokenInfo{AccessToken: "personal", Expiry: now.Add(time.Hour)})
+	if got := cache.Get(request.WithSubject("")); got == nil || got.AccessToken != "personal" {
+		t.Fatalf("expected the personal token, got %+v", got)
+	}
+
+	// Two accounts with the same request don't clobber each other
+	cache.Set(request.WithSubject("break-glass"), &types.TokenInfo{AccessToken: "break-glass", Expiry: now.Add(2 * time.Hour)})
+	if got := cache.Get(request.WithSubject("personal")); got == nil || got.AccessToken != "personal" {
+		t.Errorf("personal token was overwritten: %+v", got)
+	}
+
+	// Without a subject, the most recently obtained token wins
+	found, got := cache.Find(request)
+	if got == nil || got.AccessToken != "break-glass" || found.Subject != "break-glass" {
+		t.Errorf("expected the break-glass token, got %+v under %s", got, found)
+	}
+
+	cache.Clear(found)
+	if got := cache.Get(request); got == nil || got.AccessToken != "personal" {
+		t.Errorf("expected the personal token after clearing break-glass, got %+v", got)
+	}
+
+	// A login hint selects the account regardless of expiry
+	hinted := NewKey(&config.Config{IssuerURL: "https://issuer.com", ClientID: "client", LoginHint: "breakglass@example.com"})
+	cache.Set(hinted.WithSubject("break-glass"), &types.TokenInfo{AccessToken: "break-glass", Expiry: now.Add(time.Minute)})
+	if got := cache.Get(hinted); got == nil || got.AccessToken != "break-glass" {
+		t.Errorf("expected the token of the hinted account, got %+v", got)
+	}
+	if got := cache.Get(request); got == nil || got.AccessToken != "personal" {
+		t.Errorf("expected the personal token without a login hint, got %+v", got)
+	}
+}
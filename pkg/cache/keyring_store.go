@@ -0,0 +1,221 @@
+//go:build linux
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+// Secret Service API names (https://specifications.freedesktop.org/secret-service/)
+const (
+	secretServiceName       = "org.freedesktop.secrets"
+	secretServicePath       = dbus.ObjectPath("/org/freedesktop/secrets")
+	secretDefaultCollection = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	secretServiceInterface  = "org.freedesktop.Secret.Service"
+	secretCollectionIface   = "org.freedesktop.Secret.Collection"
+	secretItemInterface     = "org.freedesktop.Secret.Item"
+	secretSessionInterface  = "org.freedesktop.Secret.Session"
+
+	// noPrompt is returned in place of a prompt object when none is needed
+	noPrompt = dbus.ObjectPath("/")
+
+	keyringApplication = "kubectl-login"
+)
+
+// secretBus is the part of a D-Bus connection used by KeyringStore
+type secretBus interface {
+	Object(dest string, path dbus.ObjectPath) dbus.BusObject
+}
+
+// secret is the Secret Service wire format of a secret, (oayays)
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// KeyringStore keeps tokens in the desktop keyring through the Secret Service
+// D-Bus API (GNOME Keyring, KWallet). Items are stored in the default
+// collection with the attributes application=kubectl-login and key set to the
+// canonical form of the cache key.
+type KeyringStore struct {
+	bus secretBus
+}
+
+// NewKeyringStore connects to the Secret Service on the session bus
+func NewKeyringStore() (*KeyringStore, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the session bus: %w", err)
+	}
+
+	return &KeyringStore{bus: conn}, nil
+}
+
+// Get returns the token stored under key
+func (s *KeyringStore) Get(key Key) (*types.TokenInfo, error) {
+	var token *types.TokenInfo
+	err := s.withSession(func(session dbus.ObjectPath) error {
+		items, err := s.search(keyringAttributes(key))
+		if err != nil || len(items) == 0 {
+			return err
+		}
+
+		entry, err := s.getSecret(items[0], session)
+		if err != nil {
+			return err
+		}
+		token = entry.token()
+		return nil
+	})
+	return token, err
+}
+
+// Set stores token under key, replacing an existing item
+func (s *KeyringStore) Set(key Key, token *types.TokenInfo) error {
+	return s.withSession(func(session dbus.ObjectPath) error {
+		value, err := json.Marshal(newStoredEntry(key, token))
+		if err != nil {
+			return err
+		}
+
+		label := "kubectl-login: " + key.IssuerURL + " (" + key.ClientID + ")"
+		if key.Subject != "" {
+			label += " " + key.Subject
+		}
+		properties := map[string]dbus.Variant{
+			secretItemInterface + ".Label":      dbus.MakeVariant(label),
+			secretItemInterface + ".Attributes": dbus.MakeVariant(keyringAttributes(key)),
+		}
+		item := secret{Session: session, Parameters: []byte{}, Value: value, ContentType: "application/json"}
+
+		var itemPath, prompt dbus.ObjectPath
+		call := s.bus.Object(secretServiceName, secretDefaultCollection).
+			Call(secretCollectionIface+".CreateItem", 0, properties, item, true)
+		if err := call.Store(&itemPath, &prompt); err != nil {
+			return fmt.Errorf("failed to store token in keyring: %w", err)
+		}
+		if prompt != noPrompt {
+			return fmt.Errorf("keyring is locked: unlock it and try again")
+		}
+		return nil
+	})
+}
+
+// Delete removes the item stored under key
+func (s *KeyringStore) Delete(key Key) error {
+	items, err := s.search(keyringAttributes(key))
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err := s.bus.Object(secretServiceName, item).Call(secretItemInterface+".Delete", 0).Store(&prompt); err != nil {
+			return fmt.Errorf("failed to delete token from keyring: %w", err)
+		}
+		if prompt != noPrompt {
+			return fmt.Errorf("keyring is locked: unlock it and try again")
+		}
+	}
+	return nil
+}
+
+// List returns the stored keys in sorted order
+func (s *KeyringStore) List() ([]Key, error) {
+	entries, err := s.All()
+	return entryKeys(entries), err
+}
+
+// All returns the stored tokens sorted by key, reading them in one session
+func (s *KeyringStore) All() ([]Entry, error) {
+	stored := make(map[string]*storedEntry)
+	err := s.withSession(func(session dbus.ObjectPath) error {
+		items, err := s.search(map[string]string{"application": keyringApplication})
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			entry, err := s.getSecret(item, session)
+			if err != nil {
+				return err
+			}
+			stored[entry.Key.String()] = entry
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortedEntries(stored), nil
+}
+
+// keyringAttributes returns the item attributes for key
+func keyringAttributes(key Key) map[string]string {
+	return map[string]string{
+		"application": keyringApplication,
+		"key":         key.String(),
+	}
+}
+
+// withSession opens a plain Secret Service session for the duration of fn.
+// Secrets travel unencrypted over the session bus, which is local to the user.
+func (s *KeyringStore) withSession(fn func(session dbus.ObjectPath) error) error {
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	call := s.bus.Object(secretServiceName, secretServicePath).
+		Call(secretServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant(""))
+	if err := call.Store(&output, &session); err != nil {
+		return fmt.Errorf("failed to open keyring session: %w", err)
+	}
+	defer s.bus.Object(secretServiceName, session).Call(secretSessionInterface+".Close", 0)
+
+	return fn(session)
+}
+
+// search returns the unlocked items matching attributes. Locked items are
+// unlocked when that doesn't require a prompt.
+func (s *KeyringStore) search(attributes map[string]string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	call := s.bus.Object(secretServiceName, secretServicePath).
+		Call(secretServiceInterface+".SearchItems", 0, attributes)
+	if err := call.Store(&unlocked, &locked); err != nil {
+		return nil, fmt.Errorf("failed to search keyring: %w", err)
+	}
+	if len(locked) == 0 {
+		return unlocked, nil
+	}
+
+	var prompt dbus.ObjectPath
+	var unlockedNow []dbus.ObjectPath
+	call = s.bus.Object(secretServiceName, secretServicePath).
+		Call(secretServiceInterface+".Unlock", 0, locked)
+	if err := call.Store(&unlockedNow, &prompt); err != nil {
+		return nil, fmt.Errorf("failed to unlock keyring: %w", err)
+	}
+	if prompt != noPrompt {
+		return nil, fmt.Errorf("keyring is locked: unlock it and try again")
+	}
+	return append(unlocked, unlockedNow...), nil
+}
+
+// getSecret reads and decodes the entry stored in item
+func (s *KeyringStore) getSecret(item, session dbus.ObjectPath) (*storedEntry, error) {
+	var value secret
+	if err := s.bus.Object(secretServiceName, item).Call(secretItemInterface+".GetSecret", 0, session).Store(&value); err != nil {
+		return nil, fmt.Errorf("failed to read token from keyring: %w", err)
+	}
+
+	var entry storedEntry
+	if err := json.Unmarshal(value.Value, &entry); err != nil {
+		return nil, fmt.Errorf("invalid keyring item %s: %w", item, err)
+	}
+	return &entry, nil
+}
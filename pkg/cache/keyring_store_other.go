@@ -0,0 +1,46 @@
+//go:build !linux
+
+package cache
+
+import (
+	"errors"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+// errKeyringUnsupported is returned on platforms without the Secret Service
+var errKeyringUnsupported = errors.New("keyring backend not supported on this platform")
+
+// KeyringStore keeps tokens in the desktop keyring through the Secret Service
+// D-Bus API, which is only supported on Linux
+type KeyringStore struct{}
+
+// NewKeyringStore fails, since the Secret Service is not available on this platform
+func NewKeyringStore() (*KeyringStore, error) {
+	return nil, errKeyringUnsupported
+}
+
+// Get fails, since the keyring is not supported on this platform
+func (s *KeyringStore) Get(key Key) (*types.TokenInfo, error) {
+	return nil, errKeyringUnsupported
+}
+
+// Set fails, since the keyring is not supported on this platform
+func (s *KeyringStore) Set(key Key, token *types.TokenInfo) error {
+	return errKeyringUnsupported
+}
+
+// Delete fails, since the keyring is not supported on this platform
+func (s *KeyringStore) Delete(key Key) error {
+	return errKeyringUnsupported
+}
+
+// List fails, since the keyring is not supported on this platform
+func (s *KeyringStore) List() ([]Key, error) {
+	return nil, errKeyringUnsupported
+}
+
+// All fails, since the keyring is not supported on this platform
+func (s *KeyringStore) All() ([]Entry, error) {
+	return nil, errKeyringUnsupported
+}
@@ -0,0 +1,206 @@
+//go:build linux
+
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+// fakeSecretService implements the Secret Service calls KeyringStore makes,
+// standing in for the session bus
+type fakeSecretService struct {
+	items    map[dbus.ObjectPath]*fakeItem
+	next     int
+	sessions map[dbus.ObjectPath]bool
+	locked   bool
+}
+
+type fakeItem struct {
+	attributes map[string]string
+	value      []byte
+	locked     bool
+}
+
+func newFakeSecretService() *fakeSecretService {
+	return &fakeSecretService{
+		items:    make(map[dbus.ObjectPath]*fakeItem),
+		sessions: make(map[dbus.ObjectPath]bool),
+	}
+}
+
+func (f *fakeSecretService) Object(dest string, path dbus.ObjectPath) dbus.BusObject {
+	return &fakeSecretObject{service: f, dest: dest, path: path}
+}
+
+type fakeSecretObject struct {
+	dbus.BusObject
+	service *fakeSecretService
+	dest    string
+	path    dbus.ObjectPath
+}
+
+func (o *fakeSecretObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	f := o.service
+	reply := func(body ...interface{}) *dbus.Call { return &dbus.Call{Body: body} }
+	fail := func(format string, a ...interface{}) *dbus.Call {
+		return &dbus.Call{Err: fmt.Errorf(format, a...)}
+	}
+
+	if o.dest != secretServiceName {
+		return fail("unknown destination %s", o.dest)
+	}
+
+	switch method {
+	case secretServiceInterface + ".OpenSession":
+		if args[0] != "plain" {
+			return fail("unsupported algorithm %v", args[0])
+		}
+		session := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/session/%d", len(f.sessions)+1))
+		f.sessions[session] = true
+		return reply(dbus.MakeVariant(""), session)
+
+	case secretSessionInterface + ".Close":
+		delete(f.sessions, o.path)
+		return reply()
+
+	case secretServiceInterface + ".SearchItems":
+		attributes := args[0].(map[string]string)
+		unlocked, locked := []dbus.ObjectPath{}, []dbus.ObjectPath{}
+		for path, item := range f.items {
+			if matches(item.attributes, attributes) {
+				if item.locked {
+					locked = append(locked, path)
+				} else {
+					unlocked = append(unlocked, path)
+				}
+			}
+		}
+		return reply(unlocked, locked)
+
+	case secretServiceInterface + ".Unlock":
+		if f.locked {
+			return reply([]dbus.ObjectPath{}, dbus.ObjectPath("/org/freedesktop/secrets/prompt/1"))
+		}
+		paths := args[0].([]dbus.ObjectPath)
+		for _, path := range paths {
+			f.items[path].locked = false
+		}
+		return reply(paths, noPrompt)
+
+	case secretCollectionIface + ".CreateItem":
+		if o.path != secretDefaultCollection {
+			return fail("unknown collection %s", o.path)
+		}
+		if f.locked {
+			return reply(dbus.ObjectPath("/"), dbus.ObjectPath("/org/freedesktop/secrets/prompt/1"))
+		}
+		properties := args[0].(map[string]dbus.Variant)
+		value := args[1].(secret)
+		if !f.sessions[value.Session] {
+			return fail("invalid session %s", value.Session)
+		}
+		attributes := properties[secretItemInterface+".Attributes"].Value().(map[string]string)
+		if args[2].(bool) {
+			for path, item := range f.items {
+				if matches(item.attributes, attributes) && matches(attributes, item.attributes) {
+					item.value = value.Value
+					return reply(path, noPrompt)
+				}
+			}
+		}
+		f.next++
+		path := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/collection/login/%d", f.next))
+		f.items[path] = &fakeItem{attributes: attributes, value: value.Value}
+		return reply(path, noPrompt)
+
+	case secretItemInterface + ".GetSecret":
+		item, ok := f.items[o.path]
+		if !ok || item.locked {
+			return fail("no unlocked item %s", o.path)
+		}
+		session := args[0].(dbus.ObjectPath)
+		if !f.sessions[session] {
+			return fail("invalid session %s", session)
+		}
+		return reply(secret{Session: session, Parameters: []byte{}, Value: item.value, ContentType: "application/json"})
+
+	case secretItemInterface + ".Delete":
+		delete(f.items, o.path)
+		return reply(noPrompt)
+	}
+	return fail("unknown method %s", method)
+}
+
+// matches reports whether attrs contains every attribute in query
+func matches(attrs, query map[string]string) bool {
+	for k, v := range query {
+		if attrs[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestKeyringStore(t *testing.T) {
+	service := newFakeSecretService()
+	testStore(t, &KeyringStore{bus: service})
+
+	if len(service.sessions) != 0 {
+		t.Errorf("sessions should be closed, %d still open", len(service.sessions))
+	}
+
+	// Items of other applications are ignored
+	service.items["/org/freedesktop/secrets/collection/login/other"] = &fakeItem{
+		attributes: map[string]string{"application": "other"},
+		value:      []byte("not json"),
+	}
+	store := &KeyringStore{bus: service}
+	if keys, err := store.List(); err != nil || len(keys) != 1 {
+		t.Errorf("List = %v, %v; want only the kubectl-login item", keys, err)
+	}
+
+	// Set replaces the existing item for a key
+	if err := store.Set(testKey("a"), &types.TokenInfo{AccessToken: "replaced"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, _ := store.Get(testKey("a")); got == nil || got.AccessToken != "replaced" {
+		t.Errorf("Get after replace = %+v", got)
+	}
+	if len(service.items) != 2 {
+		t.Errorf("expected the item to be replaced, have %d items", len(service.items))
+	}
+}
+
+func TestKeyringStore_Locked(t *testing.T) {
+	service := newFakeSecretService()
+	store := &KeyringStore{bus: service}
+	if err := store.Set(testKey("a"), &types.TokenInfo{AccessToken: "token"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	for _, item := range service.items {
+		item.locked = true
+	}
+
+	// Items that unlock without a prompt are read
+	if got, err := store.Get(testKey("a")); err != nil || got == nil {
+		t.Errorf("Get of an item unlocked without prompt = %+v, %v", got, err)
+	}
+
+	// A keyring that needs a prompt reports that it is locked
+	for _, item := range service.items {
+		item.locked = true
+	}
+	service.locked = true
+	if _, err := store.Get(testKey("a")); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("Get from a locked keyring: got %v, want a locked error", err)
+	}
+	if err := store.Set(testKey("b"), &types.TokenInfo{}); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("Set into a locked keyring: got %v, want a locked error", err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package cache
+
+import "os"
+
+// Platforms without file locking fall back to the in-process mutex only
+
+func lockFile(f *os.File) error { return nil }
+
+func tryLockFile(f *os.File) (bool, error) { return true, nil }
+
+func unlockFile(f *os.File) error { return nil }
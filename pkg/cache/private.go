@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+)
+
+// InsecureError is returned when the cache file or its directory is owned by
+// another user or accessible to other users. Tokens are neither read from nor
+// written to such a cache.
+type InsecureError struct {
+	Path string
+	Mode os.FileMode
+	// OtherOwner is set if Path is owned by another user, which Fix can't repair
+	OtherOwner bool
+}
+
+func (e *InsecureError) Error() string {
+	if e.OtherOwner {
+		return fmt.Sprintf("refusing to use token cache: %s is owned by another user", e.Path)
+	}
+	return fmt.Sprintf("refusing to use token cache: %s is accessible to other users (mode %04o): run 'chmod %04o %s' to fix it",
+		e.Path, e.Mode.Perm(), e.FixedMode().Perm(), e.Path)
+}
+
+// FixedMode returns the mode of Path without group and world permissions
+func (e *InsecureError) FixedMode() os.FileMode {
+	return e.Mode &^ 0077
+}
+
+// Fix removes the group and world permissions of Path
+func (e *InsecureError) Fix() error {
+	if e.OtherOwner {
+		return fmt.Errorf("%s is owned by another user and can't be repaired", e.Path)
+	}
+	return os.Chmod(e.Path, e.FixedMode().Perm())
+}
+
+// checkPrivate returns an InsecureError if the file or directory at path
+// exists and is not private to the current user. It can't tell on platforms
+// where the permission bits don't describe access, and accepts the file.
+func checkPrivate(path string) error {
+	if !permissionsChecked {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !ownedByCurrentUser(info) {
+		return &InsecureError{Path: path, Mode: info.Mode(), OtherOwner: true}
+	}
+	if !isPrivate(info) {
+		return &InsecureError{Path: path, Mode: info.Mode()}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package cache
+
+import "os"
+
+// permissionsChecked is false because access to files on this platform is
+// controlled by ACLs, which the permission bits don't describe. The cache file
+// relies on the ACLs of the directory it is in, e.g. the user profile.
+const permissionsChecked = false
+
+// ownedByCurrentUser reports whether info describes a file owned by the
+// current user. Ownership is not available on this platform, so the file is
+// not trusted.
+func ownedByCurrentUser(info os.FileInfo) bool {
+	return false
+}
+
+// isPrivate reports whether info describes a file private to the current
+// user. Privacy can't be checked on this platform, so the file is not
+// trusted.
+func isPrivate(info os.FileInfo) bool {
+	return false
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+func TestFileStore_RefusesInsecurePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not checked on windows")
+	}
+
+	dir := privateTempDir(t)
+	path := filepath.Join(dir, "tokens.json")
+	store := NewFileStore(path)
+	if err := store.Set(testKey("a"), &types.TokenInfo{AccessToken: "token"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// A group-readable directory, e.g. restored from a backup
+	os.Chmod(dir, 0750)
+	var insecure *InsecureError
+	if _, err := store.List(); !errors.As(err, &insecure) || insecure.Path != dir {
+		t.Fatalf("expected an InsecureError for the directory, got %v", err)
+	}
+	if err := store.Set(testKey("b"), &types.TokenInfo{}); !errors.As(err, &insecure) {
+		t.Errorf("Set should refuse an insecure cache, got %v", err)
+	}
+	if err := insecure.Fix(); err != nil {
+		t.Fatalf("Fix failed: %v", err)
+	}
+	if info, _ := os.Stat(dir); info.Mode().Perm() != 0700 {
+		t.Errorf("expected the directory tightened to 0700, got %04o", info.Mode().Perm())
+	}
+
+	// A world-readable file
+	os.Chmod(path, 0644)
+	if _, err := store.Get(testKey("a")); !errors.As(err, &insecure) || insecure.Path != path {
+		t.Fatalf("expected an InsecureError for the file, got %v", err)
+	}
+	if err := insecure.Fix(); err != nil {
+		t.Fatalf("Fix failed: %v", err)
+	}
+	if got, err := store.Get(testKey("a")); err != nil || got == nil {
+		t.Errorf("expected the token after fixing permissions, got %v, %v", got, err)
+	}
+}
+
+func TestFileStore_RefusesOtherOwner(t *testing.T) {
+	if os.Getuid() != 0 || runtime.GOOS == "windows" {
+		t.Skip("changing the owner of a file requires root")
+	}
+
+	path := filepath.Join(privateTempDir(t), "tokens.json")
+	if err := os.WriteFile(path, []byte(`{"version": 2, "entries": []}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(path, 65534, 65534); err != nil {
+		t.Skipf("failed to change owner: %v", err)
+	}
+
+	var insecure *InsecureError
+	if _, err := NewFileStore(path).List(); !errors.As(err, &insecure) || !insecure.OtherOwner {
+		t.Fatalf("expected an InsecureError for another owner, got %v", err)
+	}
+	if err := insecure.Fix(); err == nil {
+		t.Error("Fix can't change the owner and should fail")
+	}
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package cache
+
+import (
+	"os"
+	"syscall"
+)
+
+// permissionsChecked is true because the owner and permission bits describe
+// who can access a file
+const permissionsChecked = true
+
+// ownedByCurrentUser reports whether info describes a file owned by the
+// current user
+func ownedByCurrentUser(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	return int(stat.Uid) == os.Getuid()
+}
+
+// isPrivate reports whether info describes a file owned by the current user
+// that nobody else can access
+func isPrivate(info os.FileInfo) bool {
+	return ownedByCurrentUser(info) && info.Mode().Perm()&0077 == 0
+}
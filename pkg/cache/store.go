@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+// Store persists cached tokens by key. Keys are compared by their canonical
+// string form. Get returns nil without an error for keys that are not stored.
+// All returns every stored token with its key in one read of the backend.
+type Store interface {
+	Get(key Key) (*types.TokenInfo, error)
+	Set(key Key, token *types.TokenInfo) error
+	Delete(key Key) error
+	List() ([]Key, error)
+	All() ([]Entry, error)
+}
+
+// MemoryStore keeps tokens in memory for the lifetime of the process
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*storedEntry
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*storedEntry)}
+}
+
+// Get returns the token stored under key
+func (s *MemoryStore) Get(key Key) (*types.TokenInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key.String()]; ok {
+		return entry.token(), nil
+	}
+	return nil, nil
+}
+
+// Set stores token under key
+func (s *MemoryStore) Set(key Key, token *types.TokenInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key.String()] = newStoredEntry(key, token)
+	return nil
+}
+
+// Delete removes the token stored under key
+func (s *MemoryStore) Delete(key Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key.String())
+	return nil
+}
+
+// List returns the stored keys in sorted order
+func (s *MemoryStore) List() ([]Key, error) {
+	entries, err := s.All()
+	return entryKeys(entries), err
+}
+
+// All returns the stored tokens sorted by key
+func (s *MemoryStore) All() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortedEntries(s.entries), nil
+}
+
+// storedEntry is the serialized form of a token together with its key
+type storedEntry struct {
+	Key Key `json:"key"`
+	cacheEntry
+}
+
+func newStoredEntry(key Key, token *types.TokenInfo) *storedEntry {
+	return &storedEntry{Key: key, cacheEntry: *newCacheEntry(token)}
+}
+
+// sortedEntries returns stored entries indexed by canonical key as Entries
+// sorted by key
+func sortedEntries(stored map[string]*storedEntry) []Entry {
+	entries := make([]Entry, 0, len(stored))
+	for _, s := range sortedKeys(stored) {
+		entries = append(entries, Entry{Key: stored[s].Key, Token: stored[s].token()})
+	}
+	return entries
+}
+
+// entryKeys returns the keys of entries
+func entryKeys(entries []Entry) []Key {
+	keys := make([]Key, 0, len(entries))
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+	}
+	return keys
+}
@@ -0,0 +1,239 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+// privateTempDir returns a temporary directory only the current user can
+// access, as the file store requires
+func privateTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// testKey returns a cache key for client
+func testKey(client string) Key {
+	return Key{IssuerURL: "https://issuer.com", ClientID: client, TokenType: "id_token"}
+}
+
+// testStore runs the behaviour every Store implementation must share
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+
+	keyA := testKey("a")
+	keyB := Key{
+		IssuerURL:  "https://issuer.com",
+		ClientID:   "b",
+		Scopes:     []string{"email", "openid"},
+		AuthParams: map[string]string{"audience": "kubernetes"},
+		TokenType:  "access_token",
+		Subject:    "user-1",
+	}
+
+	token := &types.TokenInfo{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		IDToken:      "id",
+		Expiry:       time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+
+	if got, err := store.Get(testKey("missing")); err != nil || got != nil {
+		t.Fatalf("Get(missing) = %v, %v; want nil, nil", got, err)
+	}
+
+	if err := store.Set(keyB, token); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := store.Set(keyA, &types.TokenInfo{AccessToken: "other"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	got, err := store.Get(keyB)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got == nil || got.AccessToken != token.AccessToken || got.RefreshToken != token.RefreshToken ||
+		got.IDToken != token.IDToken || !got.Expiry.Equal(token.Expiry) {
+		t.Errorf("Get returned %+v, want %+v", got, token)
+	}
+
+	keys, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []Key{keyA, keyB}) {
+		t.Errorf("List = %v, want [a b]", keys)
+	}
+
+	entries, err := store.All()
+	if err != nil {
+		t.Fatalf("All failed: %v", err)
+	}
+	if len(entries) != 2 || !reflect.DeepEqual(entries[0].Key, keyA) || entries[1].Token.RefreshToken != token.RefreshToken {
+		t.Errorf("All = %+v, want a and b with their tokens", entries)
+	}
+
+	if err := store.Delete(keyB); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got, _ := store.Get(keyB); got != nil {
+		t.Error("token should be deleted")
+	}
+	if keys, _ := store.List(); !reflect.DeepEqual(keys, []Key{keyA}) {
+		t.Errorf("List after Delete = %v, want [a]", keys)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	testStore(t, NewFileStore(filepath.Join(privateTempDir(t), "tokens.json")))
+}
+
+func TestEncryptedFileStore(t *testing.T) {
+	path := filepath.Join(privateTempDir(t), "tokens.enc")
+	testStore(t, NewEncryptedFileStore(path, PassphraseKey("correct horse")))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read cache file: %v", err)
+	}
+	if bytes.Contains(data, []byte("other")) {
+		t.Error("cache file should not contain tokens in plaintext")
+	}
+
+	// A new store with the same passphrase reads the file
+	if got, err := NewEncryptedFileStore(path, PassphraseKey("correct horse")).Get(testKey("a")); err != nil || got == nil || got.AccessToken != "other" {
+		t.Errorf("Get with the same passphrase = %+v, %v", got, err)
+	}
+
+	// A wrong passphrase fails without overwriting the cache
+	wrong := NewEncryptedFileStore(path, PassphraseKey("wrong"))
+	if _, err := wrong.Get(testKey("a")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Get with a wrong passphrase: got %v, want ErrDecrypt", err)
+	}
+	if err := wrong.Set(testKey("c"), &types.TokenInfo{}); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Set with a wrong passphrase: got %v, want ErrDecrypt", err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, data) {
+		t.Error("a wrong passphrase should not modify the cache file")
+	}
+}
+
+func TestKeyFile(t *testing.T) {
+	dir := privateTempDir(t)
+	key := bytes.Repeat([]byte{7}, keySize)
+
+	raw := filepath.Join(dir, "raw.key")
+	encoded := filepath.Join(dir, "base64.key")
+	short := filepath.Join(dir, "short.key")
+	os.WriteFile(raw, key, 0600)
+	os.WriteFile(encoded, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+	os.WriteFile(short, []byte("too short"), 0600)
+
+	path := filepath.Join(dir, "tokens.enc")
+	rawKey, err := KeyFile(raw)
+	if err != nil {
+		t.Fatalf("KeyFile(raw) failed: %v", err)
+	}
+	if err := NewEncryptedFileStore(path, rawKey).Set(testKey("a"), &types.TokenInfo{AccessToken: "token"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// The same key in base64 opens the file
+	encodedKey, err := KeyFile(encoded)
+	if err != nil {
+		t.Fatalf("KeyFile(base64) failed: %v", err)
+	}
+	if got, err := NewEncryptedFileStore(path, encodedKey).Get(testKey("a")); err != nil || got == nil {
+		t.Errorf("Get with the base64 key = %+v, %v", got, err)
+	}
+
+	if _, err := KeyFile(short); err == nil {
+		t.Error("expected an error for a key of the wrong length")
+	}
+	if _, err := KeyFile(filepath.Join(dir, "missing.key")); err == nil {
+		t.Error("expected an error for a missing key file")
+	}
+}
+
+func TestTokenCache_WithStore(t *testing.T) {
+	store := NewMemoryStore()
+	store.Set(Key{IssuerURL: "https://issuer.com", ClientID: "client"}, &types.TokenInfo{AccessToken: "stored"})
+
+	cache, _ := NewTokenCache(WithStore(store))
+	if got := cache.Get(Key{IssuerURL: "https://issuer.com", ClientID: "client"}); got == nil || got.AccessToken != "stored" {
+		t.Fatalf("expected the token loaded from the store, got %+v", got)
+	}
+
+	cache.Set(Key{IssuerURL: "https://issuer.com", ClientID: "other"}, &types.TokenInfo{AccessToken: "new"})
+	if got, _ := store.Get(Key{IssuerURL: "https://issuer.com", ClientID: "other"}); got == nil || got.AccessToken != "new" {
+		t.Errorf("Set should write through to the store, got %+v", got)
+	}
+
+	cache.Clear(Key{IssuerURL: "https://issuer.com", ClientID: "client"})
+	if got, _ := store.Get(Key{IssuerURL: "https://issuer.com", ClientID: "client"}); got != nil {
+		t.Error("Clear should delete from the store")
+	}
+}
+
+// countingStore counts the reads of a store
+type countingStore struct {
+	Store
+	reads int
+}
+
+func (s *countingStore) Get(key Key) (*types.TokenInfo, error) {
+	s.reads++
+	return s.Store.Get(key)
+}
+
+func (s *countingStore) List() ([]Key, error) {
+	s.reads++
+	return s.Store.List()
+}
+
+func (s *countingStore) All() ([]Entry, error) {
+	s.reads++
+	return s.Store.All()
+}
+
+func TestTokenCache_LoadReadsOnce(t *testing.T) {
+	store := &countingStore{Store: NewMemoryStore()}
+	store.Set(testKey("a"), &types.TokenInfo{AccessToken: "a"})
+	store.Set(testKey("b"), &types.TokenInfo{AccessToken: "b"})
+
+	cache, err := NewTokenCache(WithStore(store))
+	if err != nil {
+		t.Fatalf("NewTokenCache failed: %v", err)
+	}
+	if len(cache.Entries()) != 2 || store.reads != 1 {
+		t.Errorf("expected both tokens loaded in a single read, got %d entries in %d reads", len(cache.Entries()), store.reads)
+	}
+}
+
+func TestTokenCache_Entries(t *testing.T) {
+	cache, _ := NewTokenCache(WithStore(NewMemoryStore()))
+	cache.Set(testKey("b"), &types.TokenInfo{AccessToken: "b"})
+	cache.Set(testKey("a"), &types.TokenInfo{AccessToken: "a"})
+
+	entries := cache.Entries()
+	if len(entries) != 2 || entries[0].Key.ClientID != "a" || entries[1].Token.AccessToken != "b" {
+		t.Errorf("expected entries a and b in order, got %+v", entries)
+	}
+}
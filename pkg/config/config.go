@@ -1,40 +1,410 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Token types that can be presented to the Kubernetes API server
+const (
+	TokenTypeIDToken     = "id_token"
+	TokenTypeAccessToken = "access_token"
+)
+
+// DefaultScopes are requested when no scopes are configured
+var DefaultScopes = []string{"openid", "profile", "email", "offline_access"}
+
+// DefaultMinValidity is how long a cached token must remain valid to be used
+// without refreshing it, unless min_validity is set
+const DefaultMinValidity = 5 * time.Minute
+
+// LoginTimeout is how long a browser login waits for the provider's callback
+const LoginTimeout = 5 * time.Minute
+
+// Token cache backends
+const (
+	CacheBackendFile          = "file"
+	CacheBackendEncryptedFile = "encrypted-file"
+	CacheBackendMemory        = "memory"
+	CacheBackendKeyring       = "keyring"
 )
 
 // Config holds the authentication configuration
 type Config struct {
-	IssuerURL    string `json:"issuer_url"`
-	ClientID     string `json:"client_id"`
-	ClientSecret string `json:"client_secret"`
-	Headless     bool   `json:"headless"`
-	Port         int    `json:"port"`
+	IssuerURL      string            `json:"issuer_url" yaml:"issuer_url"`
+	ClientID       string            `json:"client_id" yaml:"client_id"`
+	ClientSecret   string            `json:"client_secret" yaml:"client_secret"`
+	Headless       bool              `json:"headless" yaml:"headless"`
+	Port           string            `json:"port" yaml:"port"`
+	Manual         bool              `json:"manual,omitempty" yaml:"manual,omitempty"`
+	BrowserCommand string            `json:"browser_command,omitempty" yaml:"browser_command,omitempty"`
+	TokenType      string            `json:"token_type,omitempty" yaml:"token_type,omitempty"`
+	Scopes         []string          `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+	AuthParams     map[string]string `json:"auth_params,omitempty" yaml:"auth_params,omitempty"`
+	LoginHint      string            `json:"login_hint,omitempty" yaml:"login_hint,omitempty"`
+	CacheBackend   string            `json:"cache_backend,omitempty" yaml:"cache_backend,omitempty"`
+	CacheKeyFile   string            `json:"cache_key_file,omitempty" yaml:"cache_key_file,omitempty"`
+	CacheDir       string            `json:"cache_dir,omitempty" yaml:"cache_dir,omitempty"`
+	NoCache        bool              `json:"no_cache,omitempty" yaml:"no_cache,omitempty"`
+	MinValidity    string            `json:"min_validity,omitempty" yaml:"min_validity,omitempty"`
 }
 
-// LoadFromFile loads configuration from a JSON file
-func LoadFromFile(path string) (*Config, error) {
+// File is the configuration file layout. Top-level settings apply to every
+// profile; each named profile overrides the settings it sets.
+type File struct {
+	Config `yaml:",inline"`
+
+	// Profiles holds named configurations selected with --profile
+	Profiles map[string]*Config `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+	// Contexts maps kubeconfig context names to profile names
+	Contexts map[string]string `json:"contexts,omitempty" yaml:"contexts,omitempty"`
+
+	// lines maps the dotted path of each field set in the file to its line
+	lines map[string]int
+}
+
+// Merge overrides the fields of c with the non-zero fields of other
+func (c *Config) Merge(other *Config) {
+	if other.IssuerURL != "" {
+		c.IssuerURL = other.IssuerURL
+	}
+	if other.ClientID != "" {
+		c.ClientID = other.ClientID
+	}
+	if other.ClientSecret != "" {
+		c.ClientSecret = other.ClientSecret
+	}
+	if other.Headless {
+		c.Headless = other.Headless
+	}
+	if other.Port != "" {
+		c.Port = other.Port
+	}
+	if other.Manual {
+		c.Manual = other.Manual
+	}
+	if other.BrowserCommand != "" {
+		c.BrowserCommand = other.BrowserCommand
+	}
+	if other.TokenType != "" {
+		c.TokenType = other.TokenType
+	}
+	if len(other.Scopes) > 0 {
+		c.Scopes = append([]string(nil), other.Scopes...)
+	}
+	if len(other.AuthParams) > 0 {
+		params := make(map[string]string, len(c.AuthParams)+len(other.AuthParams))
+		for k, v := range c.AuthParams {
+			params[k] = v
+		}
+		for k, v := range other.AuthParams {
+			params[k] = v
+		}
+		c.AuthParams = params
+	}
+	if other.LoginHint != "" {
+		c.LoginHint = other.LoginHint
+	}
+	if other.CacheBackend != "" {
+		c.CacheBackend = other.CacheBackend
+	}
+	if other.CacheKeyFile != "" {
+		c.CacheKeyFile = other.CacheKeyFile
+	}
+	if other.CacheDir != "" {
+		c.CacheDir = other.CacheDir
+	}
+	if other.NoCache {
+		c.NoCache = other.NoCache
+	}
+	if other.MinValidity != "" {
+		c.MinValidity = other.MinValidity
+	}
+}
+
+// MinValidityDuration returns how long a cached token must remain valid to be
+// used without refreshing it. Validate checks that MinValidity parses.
+func (c *Config) MinValidityDuration() time.Duration {
+	if d, err := time.ParseDuration(c.MinValidity); err == nil {
+		return d
+	}
+	return DefaultMinValidity
+}
+
+// PortAuto lets the OS pick a free port for the OAuth callback
+const PortAuto = "auto"
+
+// CallbackPorts returns the ports to try in order for the OAuth callback. Port
+// is a port, a range such as 8000-8010, auto, or a comma-separated list of
+// these. Auto is returned as port 0.
+func (c *Config) CallbackPorts() ([]int, error) {
+	var ports []int
+	for _, item := range strings.Split(c.Port, ",") {
+		item = strings.TrimSpace(item)
+		if item == PortAuto {
+			ports = append(ports, 0)
+			continue
+		}
+
+		first, last, isRange := strings.Cut(item, "-")
+		from, err := parsePort(first)
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if isRange {
+			if to, err = parsePort(last); err != nil {
+				return nil, err
+			}
+			if to < from {
+				return nil, fmt.Errorf("invalid port range %q", item)
+			}
+		}
+		for port := from; port <= to; port++ {
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+// parsePort parses a port between 1 and 65535
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+// BrowserCommandArgs splits BrowserCommand into the program and its arguments
+// at white space. Arguments containing spaces can be quoted with single or
+// double quotes. It returns nil if no browser command is set.
+func (c *Config) BrowserCommandArgs() ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range c.BrowserCommand {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in browser command %q", c.BrowserCommand)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// Profile returns the configuration for the named profile merged over the
+// top-level settings. An empty name returns the top-level settings.
+func (f *File) Profile(name string) (*Config, error) {
+	cfg := f.Config
+	cfg.Scopes = append([]string(nil), f.Scopes...)
+	cfg.AuthParams = nil
+	cfg.Merge(&Config{AuthParams: f.AuthParams})
+	if name == "" {
+		return &cfg, nil
+	}
+
+	profile, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found (available: %s)", name, strings.Join(f.ProfileNames(), ", "))
+	}
+	if profile != nil {
+		cfg.Merge(profile)
+
+		// Merge can't tell false from unset, so a profile turning off a
+		// setting of the top level is applied here
+		prefix := "profiles." + name + "."
+		if f.isSet(prefix + "headless") {
+			cfg.Headless = profile.Headless
+		}
+		if f.isSet(prefix + "manual") {
+			cfg.Manual = profile.Manual
+		}
+		if f.isSet(prefix + "no_cache") {
+			cfg.NoCache = profile.NoCache
+		}
+	}
+
+	return &cfg, nil
+}
+
+// isSet reports whether the field at the dotted path is set in the file
+func (f *File) isSet(path string) bool {
+	_, ok := f.lines[path]
+	return ok
+}
+
+// ProfileForContext returns the profile to use for a kubeconfig context: an
+// explicit mapping in Contexts, otherwise a profile with the same name as the
+// context. It returns an empty string if neither exists.
+func (f *File) ProfileForContext(kubeContext string) string {
+	if kubeContext == "" {
+		return ""
+	}
+	if name, ok := f.Contexts[kubeContext]; ok {
+		return name
+	}
+	if _, ok := f.Profiles[kubeContext]; ok {
+		return kubeContext
+	}
+	return ""
+}
+
+// ProfileNames returns the sorted profile names
+func (f *File) ProfileNames() []string {
+	return sortedKeys(f.Profiles)
+}
+
+// sortedKeys returns the sorted keys of a map
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// LoadFile loads a YAML or JSON configuration file, including its profiles.
+// The format is chosen by file extension, or by content for other extensions.
+// Unknown fields are rejected and invalid settings are reported with their line.
+func LoadFile(path string) (*File, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
+	file, err := parse(data, isJSON(path, data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return file, nil
+}
+
+// LoadFromFile loads the top-level configuration from a YAML or JSON file
+func LoadFromFile(path string) (*Config, error) {
+	file, err := LoadFile(path)
+	if err != nil {
 		return nil, err
 	}
 
-	return &cfg, nil
+	return file.Profile("")
 }
 
-// SaveToFile saves configuration to a JSON file
+// SaveToFile saves configuration to a file, as YAML for .yaml/.yml paths and JSON otherwise
 func SaveToFile(cfg *Config, path string) error {
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(cfg)
+	default:
+		data, err = json.MarshalIndent(cfg, "", "  ")
+	}
 	if err != nil {
 		return err
 	}
 
 	return os.WriteFile(path, data, 0600)
 }
+
+// isJSON reports whether a config file should be parsed as JSON
+func isJSON(path string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return true
+	case ".yaml", ".yml":
+		return false
+	}
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// parse decodes and validates configuration data
+func parse(data []byte, asJSON bool) (*File, error) {
+	if asJSON {
+		// Report JSON syntax errors with their position before the strict decode,
+		// which would otherwise accept YAML-only syntax in a JSON file
+		var raw interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return nil, fmt.Errorf("line %d: %w", lineAt(data, syntaxErr.Offset), err)
+			}
+			return nil, err
+		}
+	}
+
+	var file File
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && err != io.EOF {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			msg := strings.Join(typeErr.Errors, "\n")
+			return nil, errors.New(unknownFieldPattern.ReplaceAllString(msg, `unknown field "$1"`))
+		}
+		return nil, err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	lines := make(map[string]int)
+	fieldLines(&root, "", lines)
+	file.lines = lines
+
+	if err := file.validate(lines); err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// unknownFieldPattern matches yaml.v3 unknown field messages, which name Go types
+var unknownFieldPattern = regexp.MustCompile(`field (\S+) not found in type \S+`)
+
+// lineAt returns the 1-based line number of a byte offset
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
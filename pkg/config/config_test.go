@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -40,8 +42,8 @@ func TestLoadFromFile(t *testing.T) {
 	if !cfg.Headless {
 		t.Error("Expected headless to be true")
 	}
-	if cfg.Port != 9000 {
-		t.Errorf("Expected port 9000, got %d", cfg.Port)
+	if cfg.Port != "9000" {
+		t.Errorf("Expected port 9000, got %s", cfg.Port)
 	}
 }
 
@@ -75,7 +77,7 @@ func TestSaveToFile(t *testing.T) {
 		ClientID:     "test-client-id",
 		ClientSecret: "test-secret",
 		Headless:     true,
-		Port:         9000,
+		Port:         "9000",
 	}
 
 	if err := SaveToFile(cfg, configPath); err != nil {
@@ -130,3 +132,472 @@ func TestSaveToFile_EmptyConfig(t *testing.T) {
 	}
 }
 
+func TestLoadFile_Profiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+
+	configData := `{
+  "issuer_url": "https://test-issuer.com",
+  "client_id": "default-client",
+  "port": 9000,
+  "profiles": {
+    "dev": {
+      "client_id": "dev-client",
+      "scopes": ["openid", "groups"]
+    },
+    "prod": {
+      "issuer_url": "https://prod-issuer.com",
+      "client_id": "prod-client",
+      "headless": true,
+      "token_type": "access_token"
+    }
+  },
+  "contexts": {
+    "prod-cluster-admin": "prod"
+  }
+}`
+
+	if err := os.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	file, err := LoadFile(configPath)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+
+	dev, err := file.Profile("dev")
+	if err != nil {
+		t.Fatalf("Profile(dev) failed: %v", err)
+	}
+	if dev.IssuerURL != "https://test-issuer.com" {
+		t.Errorf("Expected dev to inherit issuer_url, got '%s'", dev.IssuerURL)
+	}
+	if dev.ClientID != "dev-client" {
+		t.Errorf("Expected client_id 'dev-client', got '%s'", dev.ClientID)
+	}
+	if dev.Port != "9000" {
+		t.Errorf("Expected dev to inherit port 9000, got %s", dev.Port)
+	}
+	if len(dev.Scopes) != 2 || dev.Scopes[1] != "groups" {
+		t.Errorf("Expected scopes [openid groups], got %v", dev.Scopes)
+	}
+
+	prod, err := file.Profile("prod")
+	if err != nil {
+		t.Fatalf("Profile(prod) failed: %v", err)
+	}
+	if prod.IssuerURL != "https://prod-issuer.com" || !prod.Headless || prod.TokenType != TokenTypeAccessToken {
+		t.Errorf("Unexpected prod profile: %+v", prod)
+	}
+
+	// Top-level settings are not modified by profile lookups
+	top, err := file.Profile("")
+	if err != nil {
+		t.Fatalf("Profile(\"\") failed: %v", err)
+	}
+	if top.ClientID != "default-client" {
+		t.Errorf("Expected top-level client_id 'default-client', got '%s'", top.ClientID)
+	}
+
+	if _, err := file.Profile("missing"); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+}
+
+func TestFile_ProfileForContext(t *testing.T) {
+	file := &File{
+		Profiles: map[string]*Config{
+			"dev":  {ClientID: "dev-client"},
+			"prod": {ClientID: "prod-client"},
+		},
+		Contexts: map[string]string{
+			"prod-cluster-admin": "prod",
+		},
+	}
+
+	tests := map[string]string{
+		"prod-cluster-admin": "prod",
+		"dev":                "dev",
+		"unknown":            "",
+		"":                   "",
+	}
+	for context, expected := range tests {
+		if got := file.ProfileForContext(context); got != expected {
+			t.Errorf("ProfileForContext(%q): expected %q, got %q", context, expected, got)
+		}
+	}
+}
+
+func TestLoadFile_UnknownContextProfile(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+
+	configData := `{"profiles": {"dev": {"client_id": "dev"}}, "contexts": {"prod": "prod"}}`
+	if err := os.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	if _, err := LoadFile(configPath); err == nil {
+		t.Error("Expected error for context mapped to unknown profile")
+	}
+}
+
+func TestLoadFile_YAML(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configData := `issuer_url: https://test-issuer.com
+client_id: test-client-id
+port: 9000
+profiles:
+  dev:
+    client_id: dev-client
+    scopes: [openid, groups]
+contexts:
+  dev-cluster: dev
+`
+
+	if err := os.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	file, err := LoadFile(configPath)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+
+	if file.IssuerURL != "https://test-issuer.com" || file.ClientID != "test-client-id" || file.Port != "9000" {
+		t.Errorf("Unexpected top-level config: %+v", file.Config)
+	}
+
+	dev, err := file.Profile(file.ProfileForContext("dev-cluster"))
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	if dev.ClientID != "dev-client" || len(dev.Scopes) != 2 {
+		t.Errorf("Unexpected dev profile: %+v", dev)
+	}
+}
+
+func TestFile_ProfileTurnsOffSetting(t *testing.T) {
+	configData := `issuer_url: https://test-issuer.com
+client_id: test-client-id
+headless: true
+no_cache: true
+profiles:
+  laptop:
+    headless: false
+  ci: {}
+`
+	file, err := parse([]byte(configData), false)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	laptop, err := file.Profile("laptop")
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	if laptop.Headless || !laptop.NoCache {
+		t.Errorf("Expected the laptop profile to turn off headless only, got %+v", laptop)
+	}
+	ci, err := file.Profile("ci")
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	if !ci.Headless || !ci.NoCache {
+		t.Errorf("Expected the ci profile to inherit the top-level settings, got %+v", ci)
+	}
+}
+
+func TestFile_ProfileCacheSettings(t *testing.T) {
+	configData := `issuer_url: https://test-issuer.com
+client_id: test-client-id
+profiles:
+  shared:
+    cache_dir: /srv/kubectl-login
+    no_cache: true
+    min_validity: 10m
+`
+	file, err := parse([]byte(configData), false)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	shared, err := file.Profile("shared")
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	if shared.CacheDir != "/srv/kubectl-login" || !shared.NoCache || shared.MinValidity != "10m" {
+		t.Errorf("Expected the profile's cache settings, got %+v", shared)
+	}
+}
+
+func TestLoadFile_ContentSniffing(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"json-config": `{"issuer_url": "https://test-issuer.com", "client_id": "json-client"}`,
+		"yaml-config": "issuer_url: https://test-issuer.com\nclient_id: yaml-client\n",
+	}
+
+	for name, data := range files {
+		configPath := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(configPath, []byte(data), 0600); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+
+		cfg, err := LoadFromFile(configPath)
+		if err != nil {
+			t.Fatalf("LoadFromFile(%s) failed: %v", name, err)
+		}
+		if expected := name[:4] + "-client"; cfg.ClientID != expected {
+			t.Errorf("Expected client_id '%s', got '%s'", expected, cfg.ClientID)
+		}
+	}
+}
+
+func TestLoadFile_UnknownField(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"config.yaml": "client_id: test-client-id\nissuerUrl: https://test-issuer.com\n",
+		"config.json": "{\n  \"client_id\": \"test-client-id\",\n  \"issuerUrl\": \"https://test-issuer.com\"\n}",
+	}
+
+	for name, data := range files {
+		configPath := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(configPath, []byte(data), 0600); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+
+		_, err := LoadFile(configPath)
+		if err == nil {
+			t.Fatalf("Expected error for unknown field in %s", name)
+		}
+		if !strings.Contains(err.Error(), "issuerUrl") {
+			t.Errorf("Expected error to name the unknown field, got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "line 2") && !strings.Contains(err.Error(), "line 3") {
+			t.Errorf("Expected error to name the line, got: %v", err)
+		}
+	}
+}
+
+func TestLoadFile_ValidationErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected []string
+	}{
+		{
+			name:     "issuer without https",
+			data:     "issuer_url: http://test-issuer.com\nclient_id: test-client-id\n",
+			expected: []string{"line 1", "issuer_url", "https"},
+		},
+		{
+			name:     "port out of range",
+			data:     "issuer_url: https://test-issuer.com\nclient_id: test-client-id\nport: 70000\n",
+			expected: []string{"line 3", "port", "65535"},
+		},
+		{
+			name:     "missing client_id",
+			data:     "issuer_url: https://test-issuer.com\nport: 9000\n",
+			expected: []string{"line 1", "client_id", "required"},
+		},
+		{
+			name:     "profile missing client_id",
+			data:     "issuer_url: https://test-issuer.com\nprofiles:\n  dev:\n    port: 9000\n",
+			expected: []string{"line 3", "profiles.dev.client_id", "required"},
+		},
+		{
+			name:     "invalid token type",
+			data:     "profiles:\n  dev:\n    client_id: dev\n    token_type: refresh_token\n",
+			expected: []string{"line 4", "profiles.dev.token_type"},
+		},
+		{
+			name:     "context mapped to unknown profile",
+			data:     "contexts:\n  prod: prod\n",
+			expected: []string{"line 2", "contexts.prod", "unknown profile"},
+		},
+	}
+
+	tmpDir := t.TempDir()
+	for _, tt := range tests {
+		configPath := filepath.Join(tmpDir, "config.yaml")
+		if err := os.WriteFile(configPath, []byte(tt.data), 0600); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+
+		_, err := LoadFile(configPath)
+		if err == nil {
+			t.Errorf("%s: expected validation error", tt.name)
+			continue
+		}
+		for _, expected := range tt.expected {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("%s: expected error to contain %q, got: %v", tt.name, expected, err)
+			}
+		}
+	}
+}
+
+func TestLoadFile_JSONSyntaxErrorLine(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+
+	if err := os.WriteFile(configPath, []byte("{\n  \"client_id\": \"test\",\n  \"port\": 9000,\n}"), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	_, err := LoadFile(configPath)
+	if err == nil {
+		t.Fatal("Expected error for trailing comma")
+	}
+	if !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("Expected error to name line 4, got: %v", err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := []*Config{
+		{},
+		{IssuerURL: "https://test-issuer.com", ClientID: "test", Port: "8000"},
+		{Port: "8000-8010,auto", Manual: true, BrowserCommand: "firefox --private-window"},
+		{IssuerURL: "http://localhost:8080/realms/test", ClientID: "test"},
+		{IssuerURL: "http://127.0.0.1:5556", ClientID: "test", TokenType: TokenTypeAccessToken},
+		{CacheBackend: CacheBackendKeyring},
+		{CacheDir: "/run/user/1000/kubectl-login", NoCache: true},
+		{MinValidity: "15m"},
+		{AuthParams: map[string]string{"audience": "kubernetes", "prompt": "login"}, LoginHint: "sre@example.com"},
+	}
+	for _, cfg := range valid {
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got: %v", cfg, err)
+		}
+	}
+
+	invalid := []*Config{
+		{IssuerURL: "http://test-issuer.com"},
+		{IssuerURL: "test-issuer.com"},
+		{Port: "-1"},
+		{Port: "8000-"},
+		{BrowserCommand: "  "},
+		{BrowserCommand: `"firefox`},
+		{TokenType: "refresh_token"},
+		{CacheBackend: "sqlite"},
+		{CacheDir: "relative/cache"},
+		{MinValidity: "ten minutes"},
+		{MinValidity: "-1m"},
+		{AuthParams: map[string]string{"redirect_uri": "https://evil.example.com"}},
+		{AuthParams: map[string]string{"login_hint": "sre@example.com"}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", cfg)
+		}
+	}
+}
+
+func TestSaveToFile_YAML(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	cfg := &Config{
+		IssuerURL: "https://test-issuer.com",
+		ClientID:  "test-client-id",
+		Port:      "9000",
+		Scopes:    []string{"openid", "groups"},
+	}
+
+	if err := SaveToFile(cfg, configPath); err != nil {
+		t.Fatalf("SaveToFile failed: %v", err)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read saved config: %v", err)
+	}
+	if !strings.Contains(string(data), "issuer_url: https://test-issuer.com") {
+		t.Errorf("Expected YAML output, got:\n%s", data)
+	}
+
+	loaded, err := LoadFromFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load saved config: %v", err)
+	}
+	if loaded.ClientID != cfg.ClientID || len(loaded.Scopes) != 2 {
+		t.Errorf("Unexpected loaded config: %+v", loaded)
+	}
+}
+
+func TestFile_ProfileAuthParams(t *testing.T) {
+	file := &File{
+		Config: Config{AuthParams: map[string]string{"audience": "kubernetes", "prompt": "login"}},
+		Profiles: map[string]*Config{
+			"break-glass": {AuthParams: map[string]string{"acr_values": "mfa", "prompt": "consent"}},
+		},
+	}
+
+	cfg, err := file.Profile("break-glass")
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	want := map[string]string{"audience": "kubernetes", "acr_values": "mfa", "prompt": "consent"}
+	if !reflect.DeepEqual(cfg.AuthParams, want) {
+		t.Errorf("Expected profile auth params merged over the top level, got %v", cfg.AuthParams)
+	}
+
+	// The top-level settings are not modified by the merge
+	if len(file.AuthParams) != 2 || file.AuthParams["prompt"] != "login" {
+		t.Errorf("Top-level auth params were modified: %v", file.AuthParams)
+	}
+}
+
+func TestConfig_CallbackPorts(t *testing.T) {
+	tests := []struct {
+		port string
+		want []int
+	}{
+		{"8000", []int{8000}},
+		{"8000,18000", []int{8000, 18000}},
+		{"8000-8002, auto", []int{8000, 8001, 8002, 0}},
+		{"auto", []int{0}},
+	}
+	for _, tt := range tests {
+		got, err := (&Config{Port: tt.port}).CallbackPorts()
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CallbackPorts(%q) = %v, %v, want %v", tt.port, got, err, tt.want)
+		}
+	}
+
+	for _, port := range []string{"", "0", "70000", "8010-8000", "eighty", "8000,"} {
+		if _, err := (&Config{Port: port}).CallbackPorts(); err == nil {
+			t.Errorf("CallbackPorts(%q) should fail", port)
+		}
+	}
+}
+
+func TestConfig_BrowserCommandArgs(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"", nil},
+		{"wslview", []string{"wslview"}},
+		{"firefox  --private-window", []string{"firefox", "--private-window"}},
+		{`google-chrome "--profile-directory=Profile 1"`, []string{"google-chrome", "--profile-directory=Profile 1"}},
+		{`'/opt/My Browser/browser' ''`, []string{"/opt/My Browser/browser", ""}},
+	}
+	for _, tt := range tests {
+		got, err := (&Config{BrowserCommand: tt.command}).BrowserCommandArgs()
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("BrowserCommandArgs(%q) = %q, %v, want %q", tt.command, got, err, tt.want)
+		}
+	}
+
+	if _, err := (&Config{BrowserCommand: `firefox "--private-window`}).BrowserCommandArgs(); err == nil {
+		t.Error("Expected an error for an unterminated quote")
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of the environment variables that override config settings
+const EnvPrefix = "KUBECTL_LOGIN_"
+
+// envVar binds an environment variable (without EnvPrefix) to a config field
+type envVar struct {
+	name string
+	set  func(cfg *Config, value string) error
+}
+
+// envVars lists the environment variable for every config field
+var envVars = []envVar{
+	{"ISSUER_URL", func(cfg *Config, value string) error {
+		cfg.IssuerURL = value
+		return nil
+	}},
+	{"CLIENT_ID", func(cfg *Config, value string) error {
+		cfg.ClientID = value
+		return nil
+	}},
+	{"CLIENT_SECRET", func(cfg *Config, value string) error {
+		cfg.ClientSecret = value
+		return nil
+	}},
+	{"HEADLESS", func(cfg *Config, value string) error {
+		headless, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		cfg.Headless = headless
+		return nil
+	}},
+	{"PORT", func(cfg *Config, value string) error {
+		if _, err := (&Config{Port: value}).CallbackPorts(); err != nil {
+			return fmt.Errorf("must be a port, a list or range of ports, or auto")
+		}
+		cfg.Port = value
+		return nil
+	}},
+	{"MANUAL", func(cfg *Config, value string) error {
+		manual, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		cfg.Manual = manual
+		return nil
+	}},
+	{"BROWSER_COMMAND", func(cfg *Config, value string) error {
+		cfg.BrowserCommand = value
+		return nil
+	}},
+	{"TOKEN_TYPE", func(cfg *Config, value string) error {
+		cfg.TokenType = value
+		return nil
+	}},
+	{"SCOPES", func(cfg *Config, value string) error {
+		cfg.Scopes = splitList(value)
+		return nil
+	}},
+	{"AUTH_PARAMS", func(cfg *Config, value string) error {
+		params, err := ParseAuthParams(splitList(value))
+		if err != nil {
+			return err
+		}
+		cfg.AuthParams = params
+		return nil
+	}},
+	{"LOGIN_HINT", func(cfg *Config, value string) error {
+		cfg.LoginHint = value
+		return nil
+	}},
+	{"CACHE_BACKEND", func(cfg *Config, value string) error {
+		cfg.CacheBackend = value
+		return nil
+	}},
+	{"CACHE_KEY_FILE", func(cfg *Config, value string) error {
+		cfg.CacheKeyFile = value
+		return nil
+	}},
+	{"CACHE_DIR", func(cfg *Config, value string) error {
+		cfg.CacheDir = value
+		return nil
+	}},
+	{"NO_CACHE", func(cfg *Config, value string) error {
+		noCache, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		cfg.NoCache = noCache
+		return nil
+	}},
+	{"MIN_VALIDITY", func(cfg *Config, value string) error {
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("must be a duration such as 10m")
+		}
+		cfg.MinValidity = value
+		return nil
+	}},
+}
+
+// Defaults returns the built-in default configuration
+func Defaults() *Config {
+	return &Config{
+		Port:         "8000",
+		TokenType:    TokenTypeIDToken,
+		CacheBackend: CacheBackendFile,
+		MinValidity:  DefaultMinValidity.String(),
+	}
+}
+
+// ApplyEnv overrides cfg with the KUBECTL_LOGIN_* environment variables that are
+// set, using lookup (normally os.LookupEnv). Unlike Merge, a variable set to a
+// zero value such as KUBECTL_LOGIN_HEADLESS=false still overrides. The legacy
+// CLIENT_SECRET variable is honored when KUBECTL_LOGIN_CLIENT_SECRET is not set.
+func ApplyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	if secret, ok := lookup("CLIENT_SECRET"); ok && secret != "" {
+		cfg.ClientSecret = secret
+	}
+
+	for _, v := range envVars {
+		value, ok := lookup(EnvPrefix + v.name)
+		if !ok {
+			continue
+		}
+		if err := v.set(cfg, strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("%s%s: %w", EnvPrefix, v.name, err)
+		}
+	}
+
+	return nil
+}
+
+// ParseAuthParams parses key=value pairs into auth params
+func ParseAuthParams(pairs []string) (map[string]string, error) {
+	params := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("must be key=value pairs (got %q)", pair)
+		}
+		params[key] = value
+	}
+	return params, nil
+}
+
+// splitList splits a comma- or space-separated list
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// mapLookup returns an os.LookupEnv replacement backed by a map
+func mapLookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	cfg := Defaults()
+	env := map[string]string{
+		"KUBECTL_LOGIN_ISSUER_URL":     "https://env-issuer.com",
+		"KUBECTL_LOGIN_CLIENT_ID":      "env-client",
+		"KUBECTL_LOGIN_CLIENT_SECRET":  "env-secret",
+		"KUBECTL_LOGIN_HEADLESS":       "true",
+		"KUBECTL_LOGIN_PORT":           "9100",
+		"KUBECTL_LOGIN_MANUAL":         "true",
+		"KUBECTL_LOGIN_TOKEN_TYPE":     "access_token",
+		"KUBECTL_LOGIN_SCOPES":         "openid, groups offline_access",
+		"KUBECTL_LOGIN_AUTH_PARAMS":    "audience=kubernetes,prompt=login",
+		"KUBECTL_LOGIN_LOGIN_HINT":     "sre@example.com",
+		"KUBECTL_LOGIN_CACHE_BACKEND":  "encrypted-file",
+		"KUBECTL_LOGIN_CACHE_KEY_FILE": "/etc/kubectl-login/cache.key",
+		"KUBECTL_LOGIN_CACHE_DIR":      "/run/user/1000/kubectl-login",
+		"KUBECTL_LOGIN_NO_CACHE":       "true",
+		"KUBECTL_LOGIN_MIN_VALIDITY":   "15m",
+		"CLIENT_SECRET":                "legacy-secret",
+	}
+
+	if err := ApplyEnv(cfg, mapLookup(env)); err != nil {
+		t.Fatalf("ApplyEnv failed: %v", err)
+	}
+
+	if cfg.IssuerURL != "https://env-issuer.com" {
+		t.Errorf("Expected issuer from env, got '%s'", cfg.IssuerURL)
+	}
+	if cfg.ClientID != "env-client" {
+		t.Errorf("Expected client ID from env, got '%s'", cfg.ClientID)
+	}
+	if cfg.ClientSecret != "env-secret" {
+		t.Errorf("Expected KUBECTL_LOGIN_CLIENT_SECRET to win over CLIENT_SECRET, got '%s'", cfg.ClientSecret)
+	}
+	if !cfg.Headless {
+		t.Error("Expected headless from env")
+	}
+	if cfg.Port != "9100" {
+		t.Errorf("Expected port 9100, got %s", cfg.Port)
+	}
+	if !cfg.Manual {
+		t.Error("Expected manual from env")
+	}
+	if cfg.TokenType != TokenTypeAccessToken {
+		t.Errorf("Expected token type from env, got '%s'", cfg.TokenType)
+	}
+	if len(cfg.Scopes) != 3 || cfg.Scopes[1] != "groups" {
+		t.Errorf("Expected scopes [openid groups offline_access], got %v", cfg.Scopes)
+	}
+	if cfg.AuthParams["audience"] != "kubernetes" || cfg.AuthParams["prompt"] != "login" {
+		t.Errorf("Expected auth params from env, got %v", cfg.AuthParams)
+	}
+	if cfg.LoginHint != "sre@example.com" {
+		t.Errorf("Expected login hint from env, got '%s'", cfg.LoginHint)
+	}
+	if cfg.CacheBackend != CacheBackendEncryptedFile || cfg.CacheKeyFile != "/etc/kubectl-login/cache.key" {
+		t.Errorf("Expected cache settings from env, got %q and %q", cfg.CacheBackend, cfg.CacheKeyFile)
+	}
+	if cfg.CacheDir != "/run/user/1000/kubectl-login" || !cfg.NoCache {
+		t.Errorf("Expected cache dir and no-cache from env, got %q and %v", cfg.CacheDir, cfg.NoCache)
+	}
+	if cfg.MinValidityDuration() != 15*time.Minute {
+		t.Errorf("Expected min validity from env, got %v", cfg.MinValidityDuration())
+	}
+}
+
+func TestApplyEnv_LegacyClientSecret(t *testing.T) {
+	cfg := Defaults()
+	if err := ApplyEnv(cfg, mapLookup(map[string]string{"CLIENT_SECRET": "legacy-secret"})); err != nil {
+		t.Fatalf("ApplyEnv failed: %v", err)
+	}
+	if cfg.ClientSecret != "legacy-secret" {
+		t.Errorf("Expected legacy CLIENT_SECRET to be honored, got '%s'", cfg.ClientSecret)
+	}
+}
+
+func TestApplyEnv_FalseOverridesFile(t *testing.T) {
+	cfg := Defaults()
+	cfg.Merge(&Config{Headless: true})
+
+	if err := ApplyEnv(cfg, mapLookup(map[string]string{"KUBECTL_LOGIN_HEADLESS": "false"})); err != nil {
+		t.Fatalf("ApplyEnv failed: %v", err)
+	}
+	if cfg.Headless {
+		t.Error("Expected KUBECTL_LOGIN_HEADLESS=false to override the config file")
+	}
+}
+
+func TestApplyEnv_InvalidValues(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"KUBECTL_LOGIN_PORT": "eighty"},
+		{"KUBECTL_LOGIN_HEADLESS": "maybe"},
+	} {
+		if err := ApplyEnv(Defaults(), mapLookup(env)); err == nil {
+			t.Errorf("Expected error for %v", env)
+		}
+	}
+}
+
+func TestPrecedence_EnvOverFileOverDefaults(t *testing.T) {
+	cfg := Defaults()
+	cfg.Merge(&Config{IssuerURL: "https://file-issuer.com", ClientID: "file-client"})
+
+	if err := ApplyEnv(cfg, mapLookup(map[string]string{"KUBECTL_LOGIN_CLIENT_ID": "env-client"})); err != nil {
+		t.Fatalf("ApplyEnv failed: %v", err)
+	}
+
+	if cfg.Port != "8000" {
+		t.Errorf("Expected default port, got %s", cfg.Port)
+	}
+	if cfg.IssuerURL != "https://file-issuer.com" {
+		t.Errorf("Expected issuer from file, got '%s'", cfg.IssuerURL)
+	}
+	if cfg.ClientID != "env-client" {
+		t.Errorf("Expected env to override file, got '%s'", cfg.ClientID)
+	}
+}
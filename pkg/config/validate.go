@@ -0,0 +1,239 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError describes an invalid configuration field
+type ValidationError struct {
+	// Field is the dotted path of the field, e.g. profiles.dev.port
+	Field string
+	// Line is the line the field is defined on, or 0 if unknown
+	Line    int
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Validate checks that the configured settings are well-formed
+func (c *Config) Validate() error {
+	return errors.Join(c.validateFields("", nil)...)
+}
+
+// validate checks the top-level settings and every profile
+func (f *File) validate(lines map[string]int) error {
+	errs := f.Config.validateFields("", lines)
+
+	if len(f.Profiles) == 0 {
+		errs = append(errs, f.Config.validateRequired("", lines)...)
+	}
+
+	for _, name := range f.ProfileNames() {
+		prefix := "profiles." + name
+		profile := f.Profiles[name]
+		if profile == nil {
+			profile = &Config{}
+		}
+		errs = append(errs, profile.validateFields(prefix, lines)...)
+
+		effective, _ := f.Profile(name)
+		errs = append(errs, effective.validateRequired(prefix, lines)...)
+	}
+
+	for _, context := range sortedKeys(f.Contexts) {
+		name := f.Contexts[context]
+		if _, ok := f.Profiles[name]; !ok {
+			errs = append(errs, newValidationError("contexts."+context, lines,
+				fmt.Sprintf("maps to unknown profile %q", name)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// reservedAuthParams are the authorization request parameters that
+// kubectl-login sets itself
+var reservedAuthParams = map[string]bool{
+	"client_id":             true,
+	"client_secret":         true,
+	"redirect_uri":          true,
+	"response_type":         true,
+	"scope":                 true,
+	"state":                 true,
+	"nonce":                 true,
+	"code_challenge":        true,
+	"code_challenge_method": true,
+	"grant_type":            true,
+}
+
+// validateFields checks the fields that are set on c
+func (c *Config) validateFields(prefix string, lines map[string]int) []error {
+	var errs []error
+
+	if c.IssuerURL != "" {
+		if msg := checkIssuerURL(c.IssuerURL); msg != "" {
+			errs = append(errs, newValidationError(join(prefix, "issuer_url"), lines, msg))
+		}
+	}
+
+	if c.Port != "" {
+		if _, err := c.CallbackPorts(); err != nil {
+			errs = append(errs, newValidationError(join(prefix, "port"), lines,
+				fmt.Sprintf("must be a port between 1 and 65535, a list or range such as 8000,18000 or 8000-8010, or auto (got %q)", c.Port)))
+		}
+	}
+
+	if c.BrowserCommand != "" {
+		if args, err := c.BrowserCommandArgs(); err != nil || len(args) == 0 {
+			errs = append(errs, newValidationError(join(prefix, "browser_command"), lines,
+				fmt.Sprintf("must be a command such as \"firefox --private-window\" (got %q)", c.BrowserCommand)))
+		}
+	}
+
+	switch c.TokenType {
+	case "", TokenTypeIDToken, TokenTypeAccessToken:
+	default:
+		errs = append(errs, newValidationError(join(prefix, "token_type"), lines,
+			fmt.Sprintf("must be %q or %q (got %q)", TokenTypeIDToken, TokenTypeAccessToken, c.TokenType)))
+	}
+
+	for _, key := range sortedKeys(c.AuthParams) {
+		if reservedAuthParams[key] {
+			errs = append(errs, newValidationError(join(prefix, "auth_params."+key), lines,
+				"is set by kubectl-login and can't be overridden"))
+		}
+		if key == "login_hint" {
+			errs = append(errs, newValidationError(join(prefix, "auth_params."+key), lines,
+				"use the login_hint setting, which also selects the cached account"))
+		}
+	}
+
+	switch c.CacheBackend {
+	case "", CacheBackendFile, CacheBackendEncryptedFile, CacheBackendMemory, CacheBackendKeyring:
+	default:
+		errs = append(errs, newValidationError(join(prefix, "cache_backend"), lines,
+			fmt.Sprintf("must be one of %q, %q, %q or %q (got %q)", CacheBackendFile, CacheBackendEncryptedFile,
+				CacheBackendMemory, CacheBackendKeyring, c.CacheBackend)))
+	}
+
+	if c.MinValidity != "" {
+		if d, err := time.ParseDuration(c.MinValidity); err != nil || d < 0 {
+			errs = append(errs, newValidationError(join(prefix, "min_validity"), lines,
+				fmt.Sprintf("must be a non-negative duration such as 10m (got %q)", c.MinValidity)))
+		}
+	}
+
+	// A relative cache directory would depend on where kubectl is run from
+	if c.CacheDir != "" && !filepath.IsAbs(c.CacheDir) {
+		errs = append(errs, newValidationError(join(prefix, "cache_dir"), lines,
+			fmt.Sprintf("must be an absolute path (got %q)", c.CacheDir)))
+	}
+
+	return errs
+}
+
+// validateRequired checks that a complete configuration has a client ID
+func (c *Config) validateRequired(prefix string, lines map[string]int) []error {
+	if c.IssuerURL != "" && c.ClientID == "" {
+		// The missing field has no line of its own, so point at the issuer it belongs to
+		return []error{&ValidationError{
+			Field:   join(prefix, "client_id"),
+			Line:    lookupLine(join(prefix, "issuer_url"), lines),
+			Message: "is required when issuer_url is set",
+		}}
+	}
+	return nil
+}
+
+// checkIssuerURL returns a message describing why an issuer URL is invalid,
+// or an empty string if it is valid. Plain http is only allowed for loopback hosts.
+func checkIssuerURL(issuerURL string) string {
+	u, err := url.Parse(issuerURL)
+	if err != nil {
+		return fmt.Sprintf("invalid URL: %v", err)
+	}
+	if u.Host == "" {
+		return fmt.Sprintf("must be an absolute URL (got %q)", issuerURL)
+	}
+
+	switch u.Scheme {
+	case "https":
+		return ""
+	case "http":
+		if isLoopback(u.Hostname()) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("must use https (got %q)", issuerURL)
+}
+
+// isLoopback reports whether host is localhost or a loopback IP
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// newValidationError creates a ValidationError for field, locating the field or
+// its closest defined parent in lines
+func newValidationError(field string, lines map[string]int, msg string) *ValidationError {
+	return &ValidationError{Field: field, Line: lookupLine(field, lines), Message: msg}
+}
+
+// lookupLine returns the line of field, falling back to its parents
+func lookupLine(field string, lines map[string]int) int {
+	for path := field; path != ""; path = parent(path) {
+		if line, ok := lines[path]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
+// fieldLines records the line of every mapping key under its dotted path
+func fieldLines(node *yaml.Node, prefix string, lines map[string]int) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			fieldLines(child, prefix, lines)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			path := join(prefix, key.Value)
+			lines[path] = key.Line
+			fieldLines(value, path, lines)
+		}
+	}
+}
+
+// join joins a dotted path prefix and a field name
+func join(prefix, field string) string {
+	if prefix == "" {
+		return field
+	}
+	return prefix + "." + field
+}
+
+// parent returns the dotted path without its last element
+func parent(path string) string {
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
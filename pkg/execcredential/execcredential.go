@@ -0,0 +1,143 @@
+package execcredential
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientauthv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+	clientauthv1beta1 "k8s.io/client-go/pkg/apis/clientauthentication/v1beta1"
+)
+
+// EnvExecInfo is the environment variable kubectl uses to pass the ExecCredential request
+const EnvExecInfo = "KUBERNETES_EXEC_INFO"
+
+// Supported ExecCredential API versions
+const (
+	APIVersionV1      = "client.authentication.k8s.io/v1"
+	APIVersionV1beta1 = "client.authentication.k8s.io/v1beta1"
+)
+
+// Request is the ExecCredential request kubectl passes to the plugin
+type Request struct {
+	// APIVersion is the version the response must use
+	APIVersion string
+	// Interactive reports whether kubectl allows the plugin to interact with the user
+	Interactive bool
+	// Cluster is set when the kubeconfig exec entry has provideClusterInfo
+	Cluster *Cluster
+}
+
+// Cluster is the cluster information kubectl passes when provideClusterInfo is set
+type Cluster struct {
+	Server                   string
+	CertificateAuthorityData []byte
+	// Config is the exec extension of the kubeconfig cluster entry
+	// (extensions: client.authentication.k8s.io/exec), if any
+	Config map[string]interface{}
+}
+
+// ParseRequest parses the value of KUBERNETES_EXEC_INFO. An empty value, as
+// passed by kubectl versions that predate the variable, yields a v1beta1 request
+// whose interactivity is given by interactiveDefault.
+func ParseRequest(execInfo string, interactiveDefault bool) (*Request, error) {
+	if execInfo == "" {
+		return &Request{APIVersion: APIVersionV1beta1, Interactive: interactiveDefault}, nil
+	}
+
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal([]byte(execInfo), &typeMeta); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", EnvExecInfo, err)
+	}
+
+	req := &Request{APIVersion: typeMeta.APIVersion}
+	var server string
+	var caData []byte
+	var config runtime.RawExtension
+
+	switch typeMeta.APIVersion {
+	case APIVersionV1:
+		var cred clientauthv1.ExecCredential
+		if err := json.Unmarshal([]byte(execInfo), &cred); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", EnvExecInfo, err)
+		}
+		req.Interactive = cred.Spec.Interactive
+		if c := cred.Spec.Cluster; c != nil {
+			server, caData, config = c.Server, c.CertificateAuthorityData, c.Config
+		}
+
+	case APIVersionV1beta1:
+		var cred clientauthv1beta1.ExecCredential
+		if err := json.Unmarshal([]byte(execInfo), &cred); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", EnvExecInfo, err)
+		}
+		req.Interactive = cred.Spec.Interactive
+		if c := cred.Spec.Cluster; c != nil {
+			server, caData, config = c.Server, c.CertificateAuthorityData, c.Config
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported ExecCredential apiVersion %q (supported: %s, %s)",
+			typeMeta.APIVersion, APIVersionV1, APIVersionV1beta1)
+	}
+
+	if server != "" {
+		req.Cluster = &Cluster{
+			Server:                   server,
+			CertificateAuthorityData: caData,
+		}
+		if len(config.Raw) > 0 {
+			if err := json.Unmarshal(config.Raw, &req.Cluster.Config); err != nil {
+				return nil, fmt.Errorf("failed to decode cluster exec config: %w", err)
+			}
+		}
+	}
+
+	return req, nil
+}
+
+// WriteResponse writes an ExecCredential response carrying token in the
+// request's API version
+func WriteResponse(w io.Writer, req *Request, token string, expiry time.Time) error {
+	expiryTime := metav1.NewTime(expiry)
+
+	var response interface{}
+	switch req.APIVersion {
+	case APIVersionV1:
+		response = &clientauthv1.ExecCredential{
+			TypeMeta: metav1.TypeMeta{APIVersion: APIVersionV1, Kind: "ExecCredential"},
+			Status: &clientauthv1.ExecCredentialStatus{
+				Token:               token,
+				ExpirationTimestamp: &expiryTime,
+			},
+		}
+	case APIVersionV1beta1:
+		response = &clientauthv1beta1.ExecCredential{
+			TypeMeta: metav1.TypeMeta{APIVersion: APIVersionV1beta1, Kind: "ExecCredential"},
+			Status: &clientauthv1beta1.ExecCredentialStatus{
+				Token:               token,
+				ExpirationTimestamp: &expiryTime,
+			},
+		}
+	default:
+		return fmt.Errorf("unsupported ExecCredential apiVersion %q", req.APIVersion)
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		return fmt.Errorf("failed to encode exec credential response: %w", err)
+	}
+	return nil
+}
+
+// Profile returns the profile named by the "profile" key of the cluster exec
+// config, or an empty string if it is not set
+func (c *Cluster) Profile() string {
+	if c == nil {
+		return ""
+	}
+	profile, _ := c.Config["profile"].(string)
+	return profile
+}
@@ -0,0 +1,127 @@
+package execcredential
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseRequest_V1(t *testing.T) {
+	execInfo := `{
+  "apiVersion": "client.authentication.k8s.io/v1",
+  "kind": "ExecCredential",
+  "spec": {
+    "interactive": true,
+    "cluster": {
+      "server": "https://k8s.example.com:6443",
+      "certificate-authority-data": "dGVzdC1jYQ==",
+      "config": {"profile": "prod"}
+    }
+  }
+}`
+
+	req, err := ParseRequest(execInfo, false)
+	if err != nil {
+		t.Fatalf("ParseRequest failed: %v", err)
+	}
+
+	if req.APIVersion != APIVersionV1 {
+		t.Errorf("Expected apiVersion %s, got %s", APIVersionV1, req.APIVersion)
+	}
+	if !req.Interactive {
+		t.Error("Expected interactive request")
+	}
+	if req.Cluster == nil {
+		t.Fatal("Expected cluster info")
+	}
+	if req.Cluster.Server != "https://k8s.example.com:6443" {
+		t.Errorf("Unexpected server: %s", req.Cluster.Server)
+	}
+	if string(req.Cluster.CertificateAuthorityData) != "test-ca" {
+		t.Errorf("Unexpected CA data: %q", req.Cluster.CertificateAuthorityData)
+	}
+	if req.Cluster.Profile() != "prod" {
+		t.Errorf("Expected profile 'prod' from cluster config, got '%s'", req.Cluster.Profile())
+	}
+}
+
+func TestParseRequest_V1beta1NonInteractive(t *testing.T) {
+	execInfo := `{"apiVersion": "client.authentication.k8s.io/v1beta1", "kind": "ExecCredential", "spec": {"interactive": false}}`
+
+	req, err := ParseRequest(execInfo, true)
+	if err != nil {
+		t.Fatalf("ParseRequest failed: %v", err)
+	}
+
+	if req.APIVersion != APIVersionV1beta1 {
+		t.Errorf("Expected apiVersion %s, got %s", APIVersionV1beta1, req.APIVersion)
+	}
+	if req.Interactive {
+		t.Error("Expected non-interactive request")
+	}
+	if req.Cluster != nil {
+		t.Errorf("Expected no cluster info, got %+v", req.Cluster)
+	}
+	if req.Cluster.Profile() != "" {
+		t.Error("Expected empty profile without cluster info")
+	}
+}
+
+func TestParseRequest_Empty(t *testing.T) {
+	req, err := ParseRequest("", true)
+	if err != nil {
+		t.Fatalf("ParseRequest failed: %v", err)
+	}
+	if req.APIVersion != APIVersionV1beta1 || !req.Interactive {
+		t.Errorf("Expected interactive v1beta1 default, got %+v", req)
+	}
+}
+
+func TestParseRequest_Invalid(t *testing.T) {
+	for _, execInfo := range []string{
+		"not json",
+		`{"apiVersion": "client.authentication.k8s.io/v1alpha1", "kind": "ExecCredential"}`,
+	} {
+		if _, err := ParseRequest(execInfo, true); err == nil {
+			t.Errorf("Expected error for %s", execInfo)
+		}
+	}
+}
+
+func TestWriteResponse(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+
+	for _, apiVersion := range []string{APIVersionV1, APIVersionV1beta1} {
+		var buf bytes.Buffer
+		if err := WriteResponse(&buf, &Request{APIVersion: apiVersion}, "test-token", expiry); err != nil {
+			t.Fatalf("WriteResponse(%s) failed: %v", apiVersion, err)
+		}
+
+		var response struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Status     struct {
+				Token               string    `json:"token"`
+				ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+			} `json:"status"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		if response.APIVersion != apiVersion || response.Kind != "ExecCredential" {
+			t.Errorf("Expected %s ExecCredential, got %s %s", apiVersion, response.APIVersion, response.Kind)
+		}
+		if response.Status.Token != "test-token" {
+			t.Errorf("Expected token 'test-token', got '%s'", response.Status.Token)
+		}
+		if !response.Status.ExpirationTimestamp.Equal(expiry) {
+			t.Errorf("Expected expiry %v, got %v", expiry, response.Status.ExpirationTimestamp)
+		}
+	}
+
+	if err := WriteResponse(&bytes.Buffer{}, &Request{APIVersion: "v0"}, "token", expiry); err == nil {
+		t.Error("Expected error for unsupported apiVersion")
+	}
+}
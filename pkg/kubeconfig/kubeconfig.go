@@ -0,0 +1,99 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ExecAPIVersion is the ExecCredential API version written to exec entries
+const ExecAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+// Options describes the kubeconfig entries that configure kubectl-login for a cluster
+type Options struct {
+	ClusterName              string
+	Server                   string
+	CertificateAuthorityData []byte
+	InsecureSkipTLSVerify    bool
+
+	UserName    string
+	ContextName string
+
+	// Command and Args are the exec plugin invocation
+	Command string
+	Args    []string
+
+	// SetCurrentContext makes ContextName the current context
+	SetCurrentContext bool
+}
+
+// Load reads a kubeconfig file, returning an empty config if it does not exist
+func Load(path string) (*clientcmdapi.Config, error) {
+	cfg, err := clientcmd.LoadFromFile(path)
+	if os.IsNotExist(err) {
+		return clientcmdapi.NewConfig(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Apply creates or updates the cluster, user and context entries in cfg.
+// Unrelated settings of existing entries, such as a context's namespace, are kept.
+func Apply(cfg *clientcmdapi.Config, opts *Options) error {
+	if opts.ClusterName == "" || opts.UserName == "" || opts.ContextName == "" {
+		return fmt.Errorf("cluster, user and context names are required")
+	}
+	if opts.Server == "" {
+		return fmt.Errorf("cluster server URL is required")
+	}
+	if opts.Command == "" {
+		return fmt.Errorf("exec command is required")
+	}
+
+	cluster, ok := cfg.Clusters[opts.ClusterName]
+	if !ok {
+		cluster = clientcmdapi.NewCluster()
+		cfg.Clusters[opts.ClusterName] = cluster
+	}
+	cluster.Server = opts.Server
+	cluster.InsecureSkipTLSVerify = opts.InsecureSkipTLSVerify
+	if len(opts.CertificateAuthorityData) > 0 {
+		cluster.CertificateAuthorityData = opts.CertificateAuthorityData
+		cluster.CertificateAuthority = ""
+	}
+
+	user, ok := cfg.AuthInfos[opts.UserName]
+	if !ok {
+		user = clientcmdapi.NewAuthInfo()
+		cfg.AuthInfos[opts.UserName] = user
+	}
+	// The exec plugin replaces any other credential source for this user
+	user.Token = ""
+	user.TokenFile = ""
+	user.AuthProvider = nil
+	user.Exec = &clientcmdapi.ExecConfig{
+		APIVersion:         ExecAPIVersion,
+		Command:            opts.Command,
+		Args:               append([]string(nil), opts.Args...),
+		InteractiveMode:    clientcmdapi.IfAvailableExecInteractiveMode,
+		ProvideClusterInfo: true,
+	}
+
+	context, ok := cfg.Contexts[opts.ContextName]
+	if !ok {
+		context = clientcmdapi.NewContext()
+		cfg.Contexts[opts.ContextName] = context
+	}
+	context.Cluster = opts.ClusterName
+	context.AuthInfo = opts.UserName
+
+	if opts.SetCurrentContext || cfg.CurrentContext == "" {
+		cfg.CurrentContext = opts.ContextName
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package kubeconfig
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func testOptions() *Options {
+	return &Options{
+		ClusterName:              "test-cluster",
+		Server:                   "https://k8s.example.com:6443",
+		CertificateAuthorityData: []byte("test-ca"),
+		UserName:                 "oidc-test",
+		ContextName:              "test-context",
+		Command:                  "kubectl-login",
+		Args:                     []string{"--issuer-url=https://test-issuer.com", "--client-id=test-client-id"},
+	}
+}
+
+func TestApply_NewConfig(t *testing.T) {
+	cfg := clientcmdapi.NewConfig()
+
+	if err := Apply(cfg, testOptions()); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	cluster := cfg.Clusters["test-cluster"]
+	if cluster == nil || cluster.Server != "https://k8s.example.com:6443" || string(cluster.CertificateAuthorityData) != "test-ca" {
+		t.Errorf("Unexpected cluster: %+v", cluster)
+	}
+
+	user := cfg.AuthInfos["oidc-test"]
+	if user == nil || user.Exec == nil {
+		t.Fatalf("Expected exec user entry, got %+v", user)
+	}
+	if user.Exec.APIVersion != ExecAPIVersion {
+		t.Errorf("Expected apiVersion %s, got %s", ExecAPIVersion, user.Exec.APIVersion)
+	}
+	if user.Exec.Command != "kubectl-login" || len(user.Exec.Args) != 2 {
+		t.Errorf("Unexpected exec command: %s %v", user.Exec.Command, user.Exec.Args)
+	}
+	if user.Exec.InteractiveMode != clientcmdapi.IfAvailableExecInteractiveMode {
+		t.Errorf("Expected interactiveMode IfAvailable, got %s", user.Exec.InteractiveMode)
+	}
+	if !user.Exec.ProvideClusterInfo {
+		t.Error("Expected provideClusterInfo to be set")
+	}
+
+	context := cfg.Contexts["test-context"]
+	if context == nil || context.Cluster != "test-cluster" || context.AuthInfo != "oidc-test" {
+		t.Errorf("Unexpected context: %+v", context)
+	}
+	if cfg.CurrentContext != "test-context" {
+		t.Errorf("Expected current context to be set for an empty kubeconfig, got '%s'", cfg.CurrentContext)
+	}
+}
+
+func TestApply_MergeExisting(t *testing.T) {
+	cfg := clientcmdapi.NewConfig()
+	cfg.Clusters["other"] = &clientcmdapi.Cluster{Server: "https://other.example.com"}
+	cfg.AuthInfos["oidc-test"] = &clientcmdapi.AuthInfo{Token: "static-token"}
+	cfg.Contexts["test-context"] = &clientcmdapi.Context{Cluster: "old", AuthInfo: "old", Namespace: "team-a"}
+	cfg.CurrentContext = "other"
+
+	if err := Apply(cfg, testOptions()); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if cfg.Clusters["other"] == nil {
+		t.Error("Expected unrelated cluster to be kept")
+	}
+	if user := cfg.AuthInfos["oidc-test"]; user.Token != "" || user.Exec == nil {
+		t.Errorf("Expected static token to be replaced by exec, got %+v", user)
+	}
+	context := cfg.Contexts["test-context"]
+	if context.Namespace != "team-a" {
+		t.Errorf("Expected context namespace to be kept, got '%s'", context.Namespace)
+	}
+	if context.Cluster != "test-cluster" || context.AuthInfo != "oidc-test" {
+		t.Errorf("Expected context to point at the new entries, got %+v", context)
+	}
+	if cfg.CurrentContext != "other" {
+		t.Errorf("Expected current context to be kept, got '%s'", cfg.CurrentContext)
+	}
+
+	opts := testOptions()
+	opts.SetCurrentContext = true
+	if err := Apply(cfg, opts); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if cfg.CurrentContext != "test-context" {
+		t.Errorf("Expected current context to be switched, got '%s'", cfg.CurrentContext)
+	}
+}
+
+func TestApply_MissingOptions(t *testing.T) {
+	opts := testOptions()
+	opts.Server = ""
+	if err := Apply(clientcmdapi.NewConfig(), opts); err == nil {
+		t.Error("Expected error for missing server")
+	}
+
+	opts = testOptions()
+	opts.UserName = ""
+	if err := Apply(clientcmdapi.NewConfig(), opts); err == nil {
+		t.Error("Expected error for missing user name")
+	}
+}
+
+func TestLoad_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load of missing file failed: %v", err)
+	}
+	if err := Apply(cfg, testOptions()); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if err := clientcmd.WriteToFile(*cfg, path); err != nil {
+		t.Fatalf("WriteToFile failed: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	user := loaded.AuthInfos["oidc-test"]
+	if user == nil || user.Exec == nil || !user.Exec.ProvideClusterInfo {
+		t.Errorf("Expected exec entry to survive a round trip, got %+v", user)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	from := "a\nb\nc\nd\n"
+	to := "a\nb\nx\nd\ne\n"
+
+	diff := Diff("old", "new", from, to)
+
+	for _, expected := range []string{"--- old\n", "+++ new\n", "@@ -1,4 +1,5 @@\n", "-c\n", "+x\n", "+e\n", " a\n"} {
+		if !strings.Contains(diff, expected) {
+			t.Errorf("Expected diff to contain %q, got:\n%s", expected, diff)
+		}
+	}
+	if strings.Index(diff, "-c\n") > strings.Index(diff, "+x\n") {
+		t.Errorf("Expected removals before additions, got:\n%s", diff)
+	}
+
+	if diff := Diff("old", "new", from, from); diff != "" {
+		t.Errorf("Expected empty diff for equal texts, got:\n%s", diff)
+	}
+
+	if diff := Diff("/dev/null", "new", "", "a\n"); !strings.Contains(diff, "@@ -0,0 +1,1 @@") {
+		t.Errorf("Expected hunk header for new file, got:\n%s", diff)
+	}
+}
@@ -0,0 +1,273 @@
+// Package session implements the policy for getting a valid token: use the
+// cached token while it is fresh, refresh it when it is about to expire, and
+// log in when it can't be refreshed. Both the interactive login and the exec
+// credential plugin use it, and other tools can use it as a library.
+package session
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/auth"
+	"github.com/chinnareddy578/kubectl-login/pkg/cache"
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+)
+
+// ErrLoginRequired is returned when no valid token can be obtained without
+// logging in and the request does not allow a login
+var ErrLoginRequired = errors.New("login required")
+
+// CacheError wraps failures to read or lock the token cache, as opposed to
+// failures to authenticate
+type CacheError struct {
+	Err error
+}
+
+func (e *CacheError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CacheError) Unwrap() error {
+	return e.Err
+}
+
+// Authenticator logs in and refreshes tokens. *auth.Authenticator implements it.
+type Authenticator interface {
+	Authenticate() (*types.TokenInfo, error)
+	RefreshToken(previous *types.TokenInfo) (*types.TokenInfo, error)
+}
+
+// Source tells how a token was obtained
+type Source int
+
+const (
+	// SourceCache is a cached token that is still fresh
+	SourceCache Source = iota
+	// SourceRefresh is a token obtained with the cached refresh token
+	SourceRefresh
+	// SourceLogin is a token obtained by logging in
+	SourceLogin
+)
+
+// Request controls how Token may obtain a token
+type Request struct {
+	// ForceRefresh ignores a cached token that is still fresh
+	ForceRefresh bool
+	// NoLogin makes Token fail with ErrLoginRequired instead of logging in
+	NoLogin bool
+	// BeforeLogin is called before a login starts
+	BeforeLogin func()
+}
+
+// Result is a valid token
+type Result struct {
+	Token *types.TokenInfo
+	// Credential is the token of the configured token type, which is
+	// presented to the API server, and Expiry is when it expires
+	Credential string
+	Expiry     time.Time
+	Source     Source
+	// SaveErr is set if a new token could not be saved to the cache. The
+	// token is still valid, but the next call will have to log in again.
+	SaveErr error
+}
+
+// Session gets valid tokens for one login configuration
+type Session struct {
+	config        *config.Config
+	cache         *cache.TokenCache
+	authenticator Authenticator
+	wait          func()
+	warn          func(error)
+}
+
+// Option configures a Session
+type Option func(*Session)
+
+// WithAuthenticator sets the authenticator used to log in and refresh
+// tokens. The default is auth.NewAuthenticator for the session's config.
+func WithAuthenticator(authenticator Authenticator) Option {
+	return func(s *Session) {
+		s.authenticator = authenticator
+	}
+}
+
+// WithWaitFunc sets a function called when another process is logging in
+// with the same configuration and the session waits for its token
+func WithWaitFunc(wait func()) Option {
+	return func(s *Session) {
+		s.wait = wait
+	}
+}
+
+// WithWarnings sets a function called with problems the session recovers
+// from, such as a refresh that failed before falling back to a login
+func WithWarnings(warn func(error)) Option {
+	return func(s *Session) {
+		s.warn = warn
+	}
+}
+
+// New creates a session for cfg that caches tokens in tokenCache
+func New(cfg *config.Config, tokenCache *cache.TokenCache, opts ...Option) *Session {
+	s := &Session{
+		config: cfg,
+		cache:  tokenCache,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.authenticator == nil {
+		s.authenticator = auth.NewAuthenticator(cfg)
+	}
+	return s
+}
+
+// Token returns a valid token. It uses the cached token if it remains valid
+// for longer than the configured minimum validity, otherwise it refreshes the
+// cached token, and if that is not possible it logs in. Only one process
+// refreshes or logs in for the same configuration at a time; the others wait
+// for its token. A refresh token the provider rejects is removed from the
+// cache, so that it is not tried again.
+func (s *Session) Token(req Request) (*Result, error) {
+	if !req.ForceRefresh {
+		if result := s.fresh(); result != nil {
+			return result, nil
+		}
+	}
+
+	// Wait for a login running in another process instead of starting a second one
+	unlock, err := s.lockLogin()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if !req.ForceRefresh {
+		if result := s.fresh(); result != nil {
+			return result, nil
+		}
+	}
+
+	if result := s.refresh(); result != nil {
+		return result, nil
+	}
+
+	if req.NoLogin {
+		return nil, ErrLoginRequired
+	}
+	if req.BeforeLogin != nil {
+		req.BeforeLogin()
+	}
+
+	token, err := s.authenticator.Authenticate()
+	if err != nil {
+		return nil, fmt.Errorf("authentication failed: %w", err)
+	}
+	credential, expiry, err := auth.CredentialToken(token, s.config.TokenType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select %s: %w", s.config.TokenType, err)
+	}
+	return &Result{
+		Token:      token,
+		Credential: credential,
+		Expiry:     expiry,
+		Source:     SourceLogin,
+		SaveErr:    s.cache.Set(TokenKey(cache.NewKey(s.config), token), token),
+	}, nil
+}
+
+// fresh returns the cached token if it remains valid for longer than the
+// minimum validity
+func (s *Session) fresh() *Result {
+	cached := s.cache.Get(cache.NewKey(s.config))
+	if cached == nil {
+		return nil
+	}
+	credential, expiry, err := auth.CredentialToken(cached, s.config.TokenType)
+	if err != nil || time.Until(expiry) <= s.config.MinValidityDuration() {
+		return nil
+	}
+	return &Result{Token: cached, Credential: credential, Expiry: expiry, Source: SourceCache}
+}
+
+// refresh refreshes the cached token. It returns nil if there is no refresh
+// token or refreshing fails.
+func (s *Session) refresh() *Result {
+	key, cached := s.cache.Find(cache.NewKey(s.config))
+	if cached == nil || cached.RefreshToken == "" {
+		return nil
+	}
+
+	refreshed, err := s.authenticator.RefreshToken(cached)
+	if auth.IsInvalidGrant(err) {
+		// The refresh token expired or was revoked, don't try it again
+		stale := *cached
+		stale.RefreshToken = ""
+		if err := s.cache.Set(key, &stale); err != nil {
+			s.warning(err)
+		}
+		return nil
+	}
+	if err != nil {
+		s.warning(err)
+		return nil
+	}
+
+	credential, expiry, err := auth.CredentialToken(refreshed, s.config.TokenType)
+	if err != nil {
+		s.warning(fmt.Errorf("refreshed token is unusable: %w", err))
+		return nil
+	}
+	return &Result{
+		Token:      refreshed,
+		Credential: credential,
+		Expiry:     expiry,
+		Source:     SourceRefresh,
+		SaveErr:    s.cache.Set(TokenKey(key, refreshed), refreshed),
+	}
+}
+
+// lockLogin takes the cross-process login lock and reloads the cache, so that
+// a token obtained by another process while waiting is picked up. Without a
+// persistent cache there is nothing to share, and no lock is taken. If the
+// other process takes too long, e.g. because its browser login was abandoned,
+// the session goes ahead without the lock.
+func (s *Session) lockLogin() (func(), error) {
+	if s.config.NoCache {
+		return func() {}, nil
+	}
+
+	unlock, err := s.cache.LockLogin(cache.NewKey(s.config), s.wait)
+	if errors.Is(err, cache.ErrLoginLockTimeout) {
+		s.warning(err)
+		unlock, err = func() {}, nil
+	}
+	if err != nil {
+		return nil, &CacheError{Err: fmt.Errorf("failed to lock token cache: %w", err)}
+	}
+	if err := s.cache.Reload(); err != nil {
+		unlock()
+		return nil, &CacheError{Err: err}
+	}
+	return unlock, nil
+}
+
+// warning passes err to the warning function, if any
+func (s *Session) warning(err error) {
+	if s.warn != nil {
+		s.warn(err)
+	}
+}
+
+// TokenKey returns the key to cache token under: key identifying the user by
+// the sub claim of the token's ID token. Without an ID token, the token
+// replaces the one cached under key, so a refresh response without an ID token
+// doesn't leave the previous token of the user behind.
+func TokenKey(key cache.Key, token *types.TokenInfo) cache.Key {
+	if identity, err := auth.ParseIdentity(token.IDToken); err == nil {
+		return key.WithSubject(identity.Subject)
+	}
+	return key
+}
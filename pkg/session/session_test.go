@@ -0,0 +1,207 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chinnareddy578/kubectl-login/pkg/cache"
+	"github.com/chinnareddy578/kubectl-login/pkg/config"
+	"github.com/chinnareddy578/kubectl-login/pkg/types"
+	"golang.org/x/oauth2"
+)
+
+// fakeAuthenticator hands out opaque access tokens and counts its calls
+type fakeAuthenticator struct {
+	refreshErr    error
+	logins        int
+	refreshes     int
+	lastRefreshed *types.TokenInfo
+}
+
+func (a *fakeAuthenticator) Authenticate() (*types.TokenInfo, error) {
+	a.logins++
+	return &types.TokenInfo{AccessToken: "login", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func (a *fakeAuthenticator) RefreshToken(previous *types.TokenInfo) (*types.TokenInfo, error) {
+	a.refreshes++
+	a.lastRefreshed = previous
+	if a.refreshErr != nil {
+		return nil, a.refreshErr
+	}
+	return &types.TokenInfo{AccessToken: "refreshed", RefreshToken: previous.RefreshToken, Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func newTestSession(t *testing.T, cached *types.TokenInfo) (*Session, *fakeAuthenticator, *cache.TokenCache, *config.Config) {
+	t.Helper()
+	cfg := &config.Config{IssuerURL: "https://issuer.com", ClientID: "client", TokenType: config.TokenTypeAccessToken, NoCache: true}
+	tokenCache, err := cache.NewTokenCache(cache.WithStore(cache.NewMemoryStore()))
+	if err != nil {
+		t.Fatalf("NewTokenCache failed: %v", err)
+	}
+	if cached != nil {
+		tokenCache.Set(cache.NewKey(cfg), cached)
+	}
+	authenticator := &fakeAuthenticator{}
+	return New(cfg, tokenCache, WithAuthenticator(authenticator)), authenticator, tokenCache, cfg
+}
+
+func TestSession_CachedToken(t *testing.T) {
+	s, authenticator, _, _ := newTestSession(t, &types.TokenInfo{AccessToken: "cached", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)})
+
+	result, err := s.Token(Request{})
+	if err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if result.Source != SourceCache || result.Credential != "cached" {
+		t.Errorf("expected the cached token, got %q from %v", result.Credential, result.Source)
+	}
+	if authenticator.logins+authenticator.refreshes != 0 {
+		t.Error("a fresh cached token should not be refreshed")
+	}
+
+	// Forcing a refresh ignores the fresh token
+	if result, err = s.Token(Request{ForceRefresh: true}); err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if result.Source != SourceRefresh || result.Credential != "refreshed" {
+		t.Errorf("expected a refreshed token, got %q from %v", result.Credential, result.Source)
+	}
+}
+
+func TestSession_Refresh(t *testing.T) {
+	s, authenticator, tokenCache, cfg := newTestSession(t, &types.TokenInfo{AccessToken: "expiring", RefreshToken: "refresh", Expiry: time.Now().Add(time.Minute)})
+
+	result, err := s.Token(Request{NoLogin: true})
+	if err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if result.Source != SourceRefresh || authenticator.refreshes != 1 {
+		t.Errorf("expected one refresh, got %d from %v", authenticator.refreshes, result.Source)
+	}
+	if cached := tokenCache.Get(cache.NewKey(cfg)); cached == nil || cached.AccessToken != "refreshed" {
+		t.Errorf("expected the refreshed token to be cached, got %+v", cached)
+	}
+}
+
+func TestSession_MinValidity(t *testing.T) {
+	s, _, _, cfg := newTestSession(t, &types.TokenInfo{AccessToken: "opaque", RefreshToken: "refresh", Expiry: time.Now().Add(8 * time.Minute)})
+
+	if result, err := s.Token(Request{}); err != nil || result.Source != SourceCache {
+		t.Errorf("a token valid for 8 minutes should be fresh with the default minimum validity, got %v", err)
+	}
+
+	cfg.MinValidity = "10m"
+	if result, err := s.Token(Request{}); err != nil || result.Source != SourceRefresh {
+		t.Errorf("a token valid for 8 minutes should be refreshed with a 10 minute minimum validity, got %v", err)
+	}
+}
+
+func TestSession_RefreshFailure(t *testing.T) {
+	s, authenticator, _, _ := newTestSession(t, &types.TokenInfo{AccessToken: "expired", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)})
+	authenticator.refreshErr = fmt.Errorf("connection refused")
+	var warnings []error
+	s.warn = func(err error) { warnings = append(warnings, err) }
+
+	loggingIn := false
+	result, err := s.Token(Request{BeforeLogin: func() { loggingIn = true }})
+	if err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if result.Source != SourceLogin || result.Credential != "login" || !loggingIn {
+		t.Errorf("expected a login after the refresh failed, got %q from %v", result.Credential, result.Source)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected the refresh failure as warning, got %v", warnings)
+	}
+}
+
+func TestSession_InvalidGrant(t *testing.T) {
+	s, authenticator, tokenCache, cfg := newTestSession(t, &types.TokenInfo{AccessToken: "expired", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Minute)})
+	authenticator.refreshErr = fmt.Errorf("oauth2: %w", &oauth2.RetrieveError{ErrorCode: "invalid_grant"})
+
+	if _, err := s.Token(Request{NoLogin: true}); !errors.Is(err, ErrLoginRequired) {
+		t.Fatalf("expected ErrLoginRequired, got %v", err)
+	}
+	cached := tokenCache.Get(cache.NewKey(cfg))
+	if cached == nil || cached.RefreshToken != "" {
+		t.Fatalf("expected the rejected refresh token to be cleared, got %+v", cached)
+	}
+
+	// The rejected refresh token is not tried again
+	if _, err := s.Token(Request{NoLogin: true}); !errors.Is(err, ErrLoginRequired) {
+		t.Fatalf("expected ErrLoginRequired, got %v", err)
+	}
+	if authenticator.refreshes != 1 {
+		t.Errorf("expected a single refresh attempt, got %d", authenticator.refreshes)
+	}
+}
+
+func TestSession_NoLogin(t *testing.T) {
+	s, authenticator, _, _ := newTestSession(t, nil)
+
+	loggingIn := false
+	if _, err := s.Token(Request{NoLogin: true, BeforeLogin: func() { loggingIn = true }}); !errors.Is(err, ErrLoginRequired) {
+		t.Fatalf("expected ErrLoginRequired, got %v", err)
+	}
+	if authenticator.logins != 0 || loggingIn {
+		t.Error("NoLogin should not start a login")
+	}
+}
+
+func TestSession_CacheLockFailure(t *testing.T) {
+	s, _, _, cfg := newTestSession(t, nil)
+	cfg.NoCache = false
+	s.cache, _ = cache.NewTokenCache(cache.WithStore(cache.NewMemoryStore()), cache.WithDir("/dev/null/kubectl-login"))
+
+	_, err := s.Token(Request{})
+	var cacheErr *CacheError
+	if !errors.As(err, &cacheErr) {
+		t.Errorf("expected a CacheError when the lock can't be taken, got %v", err)
+	}
+}
+
+func TestSession_LoginLockTimeout(t *testing.T) {
+	s, authenticator, _, cfg := newTestSession(t, nil)
+	cfg.NoCache = false
+	dir := t.TempDir()
+	s.cache, _ = cache.NewTokenCache(cache.WithStore(cache.NewMemoryStore()), cache.WithDir(dir), cache.WithLoginLockTimeout(100*time.Millisecond))
+	var warnings []error
+	s.warn = func(err error) { warnings = append(warnings, err) }
+
+	// Another process is stuck in a login
+	other, _ := cache.NewTokenCache(cache.WithStore(cache.NewMemoryStore()), cache.WithDir(dir))
+	unlock, err := other.LockLogin(cache.NewKey(cfg), nil)
+	if err != nil {
+		t.Fatalf("LockLogin failed: %v", err)
+	}
+	defer unlock()
+
+	result, err := s.Token(Request{})
+	if err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if result.Source != SourceLogin || authenticator.logins != 1 {
+		t.Errorf("expected a login without the lock, got %v", result.Source)
+	}
+	if len(warnings) != 1 || !errors.Is(warnings[0], cache.ErrLoginLockTimeout) {
+		t.Errorf("expected the lock timeout as warning, got %v", warnings)
+	}
+}
+
+func TestSession_RefreshWithoutIDToken(t *testing.T) {
+	s, _, tokenCache, cfg := newTestSession(t, nil)
+	key := cache.NewKey(cfg).WithSubject("user-1")
+	tokenCache.Set(key, &types.TokenInfo{AccessToken: "expired", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)})
+
+	// The fake authenticator's refreshed tokens have no ID token
+	if _, err := s.Token(Request{NoLogin: true}); err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	entries := tokenCache.Entries()
+	if len(entries) != 1 || entries[0].Key.Subject != "user-1" || entries[0].Token.AccessToken != "refreshed" {
+		t.Errorf("expected the refreshed token to replace the user's token, got %+v", entries)
+	}
+}
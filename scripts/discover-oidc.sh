@@ -73,7 +73,7 @@ else
     echo "💡 Next Steps:"
     echo "  1. Use the 'Issuer URL' above as your --issuer-url"
     echo "  2. Register an OAuth2 client with your provider"
-    echo "  3. Set redirect URI to: http://localhost:8000/callback"
+    echo "  3. Set redirect URI to: http://127.0.0.1:8000/callback"
     echo "  4. Get your Client ID and Client Secret"
     echo ""
     echo "For local testing with Keycloak, run: ./scripts/setup-keycloak.sh"
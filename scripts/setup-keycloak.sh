@@ -10,7 +10,7 @@ ADMIN_USER="admin"
 ADMIN_PASSWORD="admin"
 REALM_NAME="kubectl-login"
 CLIENT_ID="kubectl-login-client"
-REDIRECT_URI="http://localhost:8000/callback"
+REDIRECT_URI="http://127.0.0.1:8000/callback"
 
 RED='\033[0;31m'
 GREEN='\033[0;32m'
@@ -150,7 +150,7 @@ create_client() {
   "enabled": true,
   "clientAuthenticatorType": "client-secret",
   "redirectUris": ["${REDIRECT_URI}"],
-  "webOrigins": ["http://localhost:8000"],
+  "webOrigins": ["http://127.0.0.1:8000"],
   "standardFlowEnabled": true,
   "directAccessGrantsEnabled": true,
   "serviceAccountsEnabled": true,
@@ -134,7 +134,7 @@ EOF
 )
     
     print_info "Sending exec credential request..."
-    RESPONSE=$(echo "$REQUEST" | ./kubectl-login \
+    RESPONSE=$(KUBERNETES_EXEC_INFO="$REQUEST" ./kubectl-login get-token \
         --issuer-url "http://localhost:8080/realms/kubectl-login" \
         --client-id "kubectl-login-client" \
         --client-secret "$CLIENT_SECRET" 2>&1)
@@ -103,7 +103,7 @@ EOF
 )
 
     # Test exec credential
-    RESPONSE=$(echo "$REQUEST" | ./kubectl-login \
+    RESPONSE=$(KUBERNETES_EXEC_INFO="$REQUEST" ./kubectl-login get-token \
         --issuer-url "${ISSUER_URL}" \
         --client-id "${CLIENT_ID}" \
         --client-secret "${CLIENT_SECRET}" 2>&1)